@@ -13,6 +13,8 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	// Limit groups can reset in any IANA time zone; the runtime images may not ship tzdata.
+	_ "time/tzdata"
 
 	"115togd/internal/daemon"
 	"115togd/internal/server"
@@ -75,6 +77,10 @@ func main() {
 		Bwlimit:          "",
 		MetricsInterval:  2 * time.Second,
 		SchedulerTick:    2 * time.Second,
+		QuotaCooldown:    time.Hour,
+		RetryMaxAttempts: 5,
+		RetryBackoff:     time.Minute,
+		FileEventRetentionDays: 30,
 	}
 	if err := st.EnsureDefaultSettings(context.Background(), setDefaults); err != nil {
 		log.Fatalf("init settings: %v", err)
@@ -0,0 +1,455 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"115togd/internal/store"
+)
+
+// bisyncPlan is what one bisync run has to do, computed by a scan from the listings of
+// both sides and the listings stored after the previous successful run.
+type bisyncPlan struct {
+	CopyToDst []string
+	CopyToSrc []string
+	DeleteDst []string
+	DeleteSrc []string
+	// RenameDst moves destination versions aside before the source version replaces them (keep_both).
+	RenameDst []bisyncRename
+	Conflicts []store.JobConflict
+	// Tracked is the number of paths known at the previous run; a percentage max_delete is relative to it.
+	Tracked int
+	// Src and Dst are the listings the plan was made from.
+	Src, Dst map[string]store.ScanEntry
+}
+
+type bisyncRename struct {
+	From string
+	To   string
+}
+
+func (p *bisyncPlan) empty() bool {
+	return len(p.CopyToDst) == 0 && len(p.CopyToSrc) == 0 &&
+		len(p.DeleteDst) == 0 && len(p.DeleteSrc) == 0 && len(p.RenameDst) == 0
+}
+
+func (p *bisyncPlan) deletions() int { return len(p.DeleteDst) + len(p.DeleteSrc) }
+
+type sideChange int
+
+const (
+	sideUnchanged sideChange = iota
+	sideChanged
+	sideDeleted
+)
+
+// sameEntry compares two listings of a file. Remotes differ in mod time precision,
+// so times within a second are considered equal.
+func sameEntry(a, b store.ScanEntry) bool {
+	if a.Size != b.Size {
+		return false
+	}
+	d := a.ModTime.Sub(b.ModTime)
+	if d < 0 {
+		d = -d
+	}
+	return d <= time.Second
+}
+
+func changeOf(prev, cur map[string]store.ScanEntry, p string) sideChange {
+	pe, hadPrev := prev[p]
+	ce, hasCur := cur[p]
+	switch {
+	case !hadPrev && !hasCur:
+		return sideUnchanged
+	case !hadPrev:
+		return sideChanged
+	case !hasCur:
+		return sideDeleted
+	case sameEntry(pe, ce):
+		return sideUnchanged
+	default:
+		return sideChanged
+	}
+}
+
+// planBisync compares both sides against the previous listings. Without previous listings
+// (first run) every file counts as new, so nothing is deleted and differing files are conflicts.
+// A change on one side wins over a deletion on the other.
+func planBisync(prevSrc, prevDst, curSrc, curDst map[string]store.ScanEntry, policy string, now time.Time) bisyncPlan {
+	seen := map[string]struct{}{}
+	for _, m := range []map[string]store.ScanEntry{prevSrc, prevDst, curSrc, curDst} {
+		for p := range m {
+			seen[p] = struct{}{}
+		}
+	}
+	paths := make([]string, 0, len(seen))
+	for p := range seen {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	plan := bisyncPlan{Tracked: len(prevSrc), Src: curSrc, Dst: curDst}
+	for p := range prevDst {
+		if _, ok := prevSrc[p]; !ok {
+			plan.Tracked++
+		}
+	}
+
+	for _, p := range paths {
+		sc := changeOf(prevSrc, curSrc, p)
+		dc := changeOf(prevDst, curDst, p)
+		s, inSrc := curSrc[p]
+		d, inDst := curDst[p]
+		switch {
+		case sc == sideChanged && dc == sideChanged:
+			if sameEntry(s, d) {
+				continue
+			}
+			plan.addConflict(p, s, d, policy, now)
+		case sc == sideChanged:
+			plan.CopyToDst = append(plan.CopyToDst, p)
+		case dc == sideChanged:
+			plan.CopyToSrc = append(plan.CopyToSrc, p)
+		case sc == sideDeleted && dc == sideUnchanged && inDst:
+			plan.DeleteDst = append(plan.DeleteDst, p)
+		case dc == sideDeleted && sc == sideUnchanged && inSrc:
+			plan.DeleteSrc = append(plan.DeleteSrc, p)
+		}
+	}
+	return plan
+}
+
+func (p *bisyncPlan) addConflict(rel string, s, d store.ScanEntry, policy string, now time.Time) {
+	c := store.JobConflict{
+		Path:       rel,
+		SrcSize:    s.Size,
+		SrcModTime: s.ModTime,
+		DstSize:    d.Size,
+		DstModTime: d.ModTime,
+	}
+	switch policy {
+	case "prefer_src":
+		c.Resolution = "src"
+	case "prefer_dst":
+		c.Resolution = "dst"
+	case "keep_both":
+		c.Resolution = "keep_both"
+		c.RenamedTo = conflictPath(rel, now)
+	default:
+		c.Resolution = "src"
+		if d.ModTime.After(s.ModTime) {
+			c.Resolution = "dst"
+		}
+	}
+	switch c.Resolution {
+	case "src":
+		p.CopyToDst = append(p.CopyToDst, rel)
+	case "dst":
+		p.CopyToSrc = append(p.CopyToSrc, rel)
+	case "keep_both":
+		// The source version keeps the name; the destination version lives on under the suffix on both sides.
+		p.RenameDst = append(p.RenameDst, bisyncRename{From: rel, To: c.RenamedTo})
+		p.CopyToDst = append(p.CopyToDst, rel)
+		p.CopyToSrc = append(p.CopyToSrc, c.RenamedTo)
+	}
+	p.Conflicts = append(p.Conflicts, c)
+}
+
+// conflictPath returns "dir/name.conflict-20060102-150405.ext" for keep_both.
+func conflictPath(p string, now time.Time) string {
+	dir, file := path.Split(p)
+	ext := path.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+	if base == "" {
+		base, ext = file, ""
+	}
+	return dir + base + ".conflict-" + now.Format("20060102-150405") + ext
+}
+
+// baseline returns the listings both sides have once the plan ran: the listings the plan was
+// made from with its steps applied. Changes made while the job ran are not in them, so the
+// next scan picks them up.
+func (p *bisyncPlan) baseline() (src, dst map[string]store.ScanEntry) {
+	src = make(map[string]store.ScanEntry, len(p.Src))
+	for k, e := range p.Src {
+		src[k] = e
+	}
+	dst = make(map[string]store.ScanEntry, len(p.Dst))
+	for k, e := range p.Dst {
+		dst[k] = e
+	}
+	for _, r := range p.RenameDst {
+		if e, ok := dst[r.From]; ok {
+			e.Path = r.To
+			dst[r.To] = e
+			delete(dst, r.From)
+		}
+	}
+	for _, k := range p.CopyToDst {
+		if e, ok := src[k]; ok {
+			dst[k] = e
+		}
+	}
+	for _, k := range p.CopyToSrc {
+		if e, ok := dst[k]; ok {
+			src[k] = e
+		}
+	}
+	for _, k := range p.DeleteDst {
+		delete(dst, k)
+	}
+	for _, k := range p.DeleteSrc {
+		delete(src, k)
+	}
+	return src, dst
+}
+
+// touched returns every path the plan writes to.
+func (p *bisyncPlan) touched() []string {
+	var out []string
+	for _, r := range p.RenameDst {
+		out = append(out, r.From, r.To)
+	}
+	out = append(out, p.CopyToDst...)
+	return append(out, p.CopyToSrc...)
+}
+
+// refreshBaseline replaces the entries of copied files in side with a listing of target, so the
+// baseline holds the mod times the remote actually stored. A file whose size no longer matches
+// was changed while the job ran; its planned entry is kept so the next scan sees the change.
+func refreshBaseline(ctx context.Context, target, listPath string, side map[string]store.ScanEntry, settings store.RuntimeSettings) error {
+	now := time.Now()
+	err := lsjson(ctx, target, []string{"--recursive", "--files-only", "--files-from-raw", listPath}, settings, func(p string, e lsjsonEntry) error {
+		if want, ok := side[p]; ok && want.Size == e.Size {
+			side[p], _ = scanEntry(p, e, nil, now)
+		}
+		return nil
+	})
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "directory not found") {
+		return nil
+	}
+	return err
+}
+
+func entryList(m map[string]store.ScanEntry) []store.ScanEntry {
+	out := make([]store.ScanEntry, 0, len(m))
+	for _, e := range m {
+		out = append(out, e)
+	}
+	return out
+}
+
+func entryMap(entries []store.ScanEntry) map[string]store.ScanEntry {
+	m := make(map[string]store.ScanEntry, len(entries))
+	for _, e := range entries {
+		m[e.Path] = e
+	}
+	return m
+}
+
+// listBisyncSide lists one side; a side that doesn't exist yet is empty.
+func listBisyncSide(ctx context.Context, target string, filter *store.FileFilter, settings store.RuntimeSettings) ([]store.ScanEntry, error) {
+	entries, err := lsjsonFiles(ctx, target, filter, settings)
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "directory not found") {
+		return nil, nil
+	}
+	return entries, err
+}
+
+func (w *ruleWorker) listBisyncSides(ctx context.Context, settings store.RuntimeSettings) (src, dst []store.ScanEntry, err error) {
+	filter, err := w.st.RuleFileFilter(ctx, w.rule)
+	if err != nil {
+		return nil, nil, fmt.Errorf("filters: %w", err)
+	}
+	filter = filter.PathsOnly()
+	src, err = listBisyncSide(ctx, ruleSource(w.rule), filter, settings)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list source: %w", err)
+	}
+	dst, err = listBisyncSide(ctx, ruleDest(w.rule), filter, settings)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list destination: %w", err)
+	}
+	return src, dst, nil
+}
+
+// scanBisync is the bisync variant of doScan: it lists both sides and leaves a plan for the scheduler.
+func (w *ruleWorker) scanBisync(ctx context.Context, settings store.RuntimeSettings) {
+	if !w.bisyncMu.TryLock() {
+		// A run is in progress; its result becomes the next baseline.
+		return
+	}
+	defer w.bisyncMu.Unlock()
+
+	now := time.Now()
+	src, dst, err := w.listBisyncSides(ctx, settings)
+	if err != nil {
+		log.Printf("rule %s: scan: %v", w.rule.ID, err)
+		return
+	}
+	prevSrc, prevDst, err := w.st.BisyncListings(ctx, w.rule.ID)
+	if err != nil {
+		log.Printf("rule %s: load bisync listings: %v", w.rule.ID, err)
+		return
+	}
+	// An unmounted disk or a wrong path looks like everything was deleted; don't propagate that.
+	if (len(src) == 0 && len(prevSrc) > 0) || (len(dst) == 0 && len(prevDst) > 0) {
+		log.Printf("rule %s: bisync: one side is empty but was not at the last run, skipping", w.rule.ID)
+		w.bisyncPlan = nil
+		return
+	}
+
+	plan := planBisync(prevSrc, prevDst, entryMap(src), entryMap(dst), w.rule.ConflictPolicy, now)
+	if plan.empty() {
+		w.bisyncPlan = nil
+		// Both sides agree: keep them as the baseline so later deletions can be told from additions.
+		if err := w.st.ReplaceBisyncListings(ctx, w.rule.ID, src, dst); err != nil {
+			log.Printf("rule %s: save bisync listings: %v", w.rule.ID, err)
+		}
+		return
+	}
+	w.bisyncPlan = &plan
+}
+
+type bisyncStep struct {
+	name  string
+	cmd   string
+	paths []string
+	from  string
+	to    string
+}
+
+// runBisyncJob executes plan as one job: renames, copies in both directions, then deletions.
+// Callers hold bisyncMu.
+func (w *ruleWorker) runBisyncJob(scanCtx, jobCtx context.Context, settings store.RuntimeSettings, port int, plan *bisyncPlan) {
+	w.bisyncPlan = nil
+	if w.stopped.Load() || scanCtx.Err() != nil {
+		return
+	}
+
+	jobID := newID()
+	baseDir := filepath.Dir(settings.LogDir)
+	jobDir := filepath.Join(baseDir, "jobs", w.rule.ID, jobID)
+	if err := os.MkdirAll(jobDir, 0o755); err != nil {
+		log.Printf("rule %s: mkdir job dir: %v", w.rule.ID, err)
+		return
+	}
+	logPath := filepath.Join(settings.LogDir, w.rule.ID, jobID+".log")
+	j := store.Job{
+		JobID:        jobID,
+		RuleID:       w.rule.ID,
+		TransferMode: w.rule.TransferMode,
+		RcPort:       port,
+		StartedAt:    time.Now(),
+		LogPath:      logPath,
+	}
+	if err := w.st.CreateJobRow(jobCtx, j); err != nil {
+		log.Printf("rule %s: create job: %v", w.rule.ID, err)
+		return
+	}
+	if err := w.st.InsertJobConflicts(jobCtx, jobID, plan.Conflicts); err != nil {
+		log.Printf("rule %s: record conflicts: %v", w.rule.ID, err)
+	}
+	log.Printf("[Worker] Job %s (Rule: %s) bisync: %d to dst, %d to src, %d dst deletions, %d src deletions, %d conflicts",
+		jobID, w.rule.ID, len(plan.CopyToDst), len(plan.CopyToSrc), len(plan.DeleteDst), len(plan.DeleteSrc), len(plan.Conflicts))
+
+	jobCtx, cancel := context.WithCancel(jobCtx)
+	defer cancel()
+
+	src, dst := ruleSource(w.rule), ruleDest(w.rule)
+	start := time.Now()
+	var bytesDone int64
+	fail := func(res jobResult, step string) {
+		speed := avgSpeed(bytesDone, start)
+		switch {
+		case errors.Is(res.Err, errTerminatedByUser):
+			_ = w.st.UpdateJobTerminated(jobCtx, jobID, "terminated by user", bytesDone, speed)
+		case errors.Is(res.Err, errTerminatedBySignal) || errors.Is(res.Err, context.Canceled):
+			_ = w.st.UpdateJobTerminated(jobCtx, jobID, "terminated", bytesDone, speed)
+		case errors.Is(res.Err, errOutsideWindow):
+			_ = w.st.UpdateJobTerminated(jobCtx, jobID, errOutsideWindow.Error(), bytesDone, speed)
+		default:
+			_ = w.st.UpdateJobFailed(jobCtx, jobID, step+": "+res.Err.Error(), bytesDone, speed)
+		}
+	}
+
+	extra, err := w.extraArgs(true)
+	if err != nil {
+		fail(jobResult{Err: err}, "args")
+		return
+	}
+	for _, r := range plan.RenameDst {
+		args := []string{"moveto", dst + "/" + r.From, dst + "/" + r.To}
+		args = append(args, rcArgs(settings, port, logPath)...)
+		res := w.runRclone(jobCtx, settings, port, args, logPath, jobID)
+		bytesDone += res.BytesDone
+		if res.Err != nil {
+			fail(res, "rename "+r.From)
+			return
+		}
+	}
+
+	steps := []bisyncStep{
+		{name: "copy-to-dst", cmd: "copy", paths: plan.CopyToDst, from: src, to: dst},
+		{name: "copy-to-src", cmd: "copy", paths: plan.CopyToSrc, from: dst, to: src},
+		{name: "delete-dst", cmd: "delete", paths: plan.DeleteDst, from: dst},
+		{name: "delete-src", cmd: "delete", paths: plan.DeleteSrc, from: src},
+	}
+	for _, step := range steps {
+		if len(step.paths) == 0 {
+			continue
+		}
+		filesFrom := filepath.Join(jobDir, step.name+".txt")
+		if err := os.WriteFile(filesFrom, []byte(strings.Join(step.paths, "\n")+"\n"), 0o600); err != nil {
+			fail(jobResult{Err: err}, step.name)
+			return
+		}
+		args := []string{step.cmd, step.from}
+		if step.to != "" {
+			args = append(args, step.to)
+		}
+		args = append(args, rcArgs(settings, port, logPath)...)
+		args = append(args, "--files-from-raw", filesFrom)
+		if step.cmd == "copy" {
+			args = append(args, w.tuningArgs(settings)...)
+		}
+		args = append(args, extra...)
+		res := w.runRclone(jobCtx, settings, port, args, logPath, jobID)
+		bytesDone += res.BytesDone
+		if res.Err != nil {
+			fail(res, step.name)
+			return
+		}
+	}
+
+	// The planned listings with the steps applied become the baseline. Only the copied paths
+	// are listed again, for the mod times the remotes stored; relisting everything would take
+	// changes made during the run for the baseline and lose them.
+	srcBase, dstBase := plan.baseline()
+	if touched := plan.touched(); len(touched) > 0 {
+		listPath := filepath.Join(jobDir, "touched.txt")
+		err := os.WriteFile(listPath, []byte(strings.Join(touched, "\n")+"\n"), 0o600)
+		if err == nil {
+			err = refreshBaseline(jobCtx, src, listPath, srcBase, settings)
+		}
+		if err == nil {
+			err = refreshBaseline(jobCtx, dst, listPath, dstBase, settings)
+		}
+		if err != nil {
+			log.Printf("rule %s: relist after bisync: %v", w.rule.ID, err)
+		}
+	}
+	if err := w.st.ReplaceBisyncListings(jobCtx, w.rule.ID, entryList(srcBase), entryList(dstBase)); err != nil {
+		log.Printf("rule %s: save bisync listings: %v", w.rule.ID, err)
+	}
+	_ = w.st.UpdateJobDone(jobCtx, jobID, bytesDone, avgSpeed(bytesDone, start))
+}
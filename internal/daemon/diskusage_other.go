@@ -0,0 +1,13 @@
+//go:build !unix
+
+package daemon
+
+import "errors"
+
+func diskUsage(path string) (total, used uint64, err error) {
+	return 0, 0, errors.New("disk usage is not supported on this platform")
+}
+
+func sameFileSystem(a, b string) (bool, error) {
+	return false, errors.New("file system identity is not supported on this platform")
+}
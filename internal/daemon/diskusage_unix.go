@@ -0,0 +1,45 @@
+//go:build unix
+
+package daemon
+
+import (
+	"path/filepath"
+	"syscall"
+)
+
+// diskUsage returns the size of the file system holding path and how much of it is in use,
+// counting the space reserved for root as used.
+func diskUsage(path string) (total, used uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	bsize := uint64(st.Bsize)
+	total = uint64(st.Blocks) * bsize
+	free := uint64(st.Bavail) * bsize
+	if free > total {
+		free = total
+	}
+	return total, total - free, nil
+}
+
+// sameFileSystem reports whether paths a and b are on the same file system. b need not exist
+// yet; its closest existing parent is used.
+func sameFileSystem(a, b string) (bool, error) {
+	var sa, sb syscall.Stat_t
+	if err := syscall.Stat(a, &sa); err != nil {
+		return false, err
+	}
+	for {
+		err := syscall.Stat(b, &sb)
+		if err == nil {
+			break
+		}
+		parent := filepath.Dir(b)
+		if err != syscall.ENOENT || parent == b {
+			return false, err
+		}
+		b = parent
+	}
+	return sa.Dev == sb.Dev, nil
+}
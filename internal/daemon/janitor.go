@@ -18,6 +18,12 @@ func StartLogJanitor(ctx context.Context, st *store.Store) {
 			log.Printf("janitor: load settings: %v", err)
 			return
 		}
+		if days := rs.FileEventRetentionDays; days > 0 {
+			cutoff := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+			if _, err := st.PruneFileEvents(ctx, cutoff); err != nil {
+				log.Printf("janitor: prune file events: %v", err)
+			}
+		}
 		days := rs.LogRetentionDays
 		if days <= 0 {
 			return
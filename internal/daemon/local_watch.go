@@ -0,0 +1,82 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"115togd/internal/store"
+)
+
+// applyLocalChanges writes the current state of paths the watcher reported below root into the
+// rule and its replicas: existing files (or every file of a directory that appeared) are
+// upserted, vanished paths removed. Files too recently modified to become stable yet are put
+// into settling with the time to look at them again.
+func (w *ruleWorker) applyLocalChanges(ctx context.Context, root string, paths map[string]struct{}, settling map[string]time.Time) error {
+	stableAfter := time.Duration(w.rule.StableSeconds)*time.Second + time.Second
+	var changed []store.ScanEntry
+	var removed []string
+	add := func(abs, rel string, fi fs.FileInfo) {
+		changed = append(changed, store.ScanEntry{Path: rel, Size: fi.Size(), ModTime: fi.ModTime()})
+		if at := fi.ModTime().Add(stableAfter); at.After(time.Now()) {
+			settling[abs] = at
+		} else {
+			delete(settling, abs)
+		}
+	}
+	for abs := range paths {
+		rel, ok := localRel(root, abs)
+		if !ok {
+			continue
+		}
+		fi, err := os.Lstat(abs)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			removed = append(removed, rel)
+			delete(settling, abs)
+		case err != nil:
+			continue
+		case fi.IsDir():
+			_ = filepath.WalkDir(abs, func(p string, d fs.DirEntry, err error) error {
+				if err != nil || !d.Type().IsRegular() {
+					return nil
+				}
+				fi, err := d.Info()
+				if r, ok := localRel(root, p); ok && err == nil {
+					add(p, r, fi)
+				}
+				return nil
+			})
+		case fi.Mode().IsRegular():
+			add(abs, rel, fi)
+		}
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+	replicas, err := w.st.ListReplicas(ctx, w.rule.ID)
+	if err != nil {
+		return err
+	}
+	if err := w.st.ApplyLocalChanges(ctx, append([]store.Rule{w.rule}, replicas...), changed, removed); err != nil {
+		return err
+	}
+	if _, err := w.st.EnqueueStable(ctx, w.rule); err != nil {
+		return err
+	}
+	return nil
+}
+
+// localRel returns p relative to root in slash form, as a scan lists it; ok is false for root
+// itself and paths outside it.
+func localRel(root, p string) (string, bool) {
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
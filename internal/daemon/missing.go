@@ -0,0 +1,27 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"115togd/internal/store"
+)
+
+// handleMissing takes the files a complete scan of rule did not list out of the queue and, for
+// rules that purge them, drops the rows once the grace period is over. Sync rules that propagate
+// the deletion pick them up in startOneJob instead.
+func (w *ruleWorker) handleMissing(ctx context.Context, rule store.Rule, scanStart time.Time) {
+	if _, err := w.st.MarkMissingFiles(ctx, rule, scanStart); err != nil {
+		log.Printf("rule %s: mark missing: %v", rule.ID, err)
+		return
+	}
+	if rule.MissingAction != "purge" {
+		return
+	}
+	if n, err := w.st.PurgeMissingFiles(ctx, rule); err != nil {
+		log.Printf("rule %s: purge missing: %v", rule.ID, err)
+	} else if n > 0 {
+		log.Printf("rule %s: purged %d files missing from the source", rule.ID, n)
+	}
+}
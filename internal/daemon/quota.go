@@ -0,0 +1,120 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"115togd/internal/store"
+)
+
+// quotaCheck is one quota a job has to fit into, in bytes or (files set) in files.
+type quotaCheck struct {
+	name   string
+	files  bool
+	limit  int64
+	budget func() (int64, error)
+}
+
+// remainingQuota returns the smallest amount left across checks, in bytes and in files
+// (0 = unlimited); ok is false once any of them is used up.
+func remainingQuota(checks []quotaCheck) (bytes, files int64, ok bool, err error) {
+	for _, q := range checks {
+		usage, err := q.budget()
+		if err != nil {
+			return 0, 0, true, err
+		}
+		if usage >= q.limit {
+			return 0, 0, false, nil
+		}
+		left := q.limit - usage
+		if q.files {
+			if files == 0 || left < files {
+				files = left
+			}
+		} else if bytes == 0 || left < bytes {
+			bytes = left
+		}
+	}
+	return bytes, files, true, nil
+}
+
+// ruleQuotas returns the rule's own daily quota over the rolling 24h window.
+func (w *ruleWorker) ruleQuotas(ctx context.Context, now time.Time) []quotaCheck {
+	if w.rule.DailyLimitBytes <= 0 {
+		return nil
+	}
+	return []quotaCheck{{name: "day", limit: w.rule.DailyLimitBytes, budget: func() (int64, error) {
+		return w.st.RuleBudgetSince(ctx, w.rule.ID, now.Add(-24*time.Hour))
+	}}}
+}
+
+// groupQuotas returns the quotas of lg that have a limit, each over the group's own window; the
+// file count shares the day window.
+func (w *ruleWorker) groupQuotas(ctx context.Context, lg store.LimitGroup, now time.Time) []quotaCheck {
+	var out []quotaCheck
+	for _, p := range lg.QuotaPeriods(now) {
+		if p.Limit <= 0 {
+			continue
+		}
+		since := p.Since
+		out = append(out, quotaCheck{name: p.Name, limit: p.Limit, budget: func() (int64, error) {
+			return w.st.GroupBudgetSince(ctx, lg.Name, since)
+		}})
+	}
+	if lg.DailyLimitFiles > 0 {
+		since := lg.QuotaPeriods(now)[0].Since
+		out = append(out, quotaCheck{name: "file", files: true, limit: lg.DailyLimitFiles, budget: func() (int64, error) {
+			return w.st.GroupFileBudgetSince(ctx, lg.Name, since)
+		}})
+	}
+	return out
+}
+
+// fallbackQuotas returns the daily quota of a group fallback; it shares the group's day window.
+func (w *ruleWorker) fallbackQuotas(ctx context.Context, lg store.LimitGroup, fb store.LimitGroupFallback, now time.Time) []quotaCheck {
+	if fb.DailyLimitBytes <= 0 {
+		return nil
+	}
+	since := lg.QuotaPeriods(now)[0].Since
+	return []quotaCheck{{name: "day", limit: fb.DailyLimitBytes, budget: func() (int64, error) {
+		return w.st.GroupFallbackBudgetSince(ctx, lg.Name, fb.DstRemote, since)
+	}}}
+}
+
+// pickServiceAccount returns the least used service account of lg that is neither paused nor out
+// of quota in the group's day window, with the quota the job then has to fit into.
+func (w *ruleWorker) pickServiceAccount(ctx context.Context, lg store.LimitGroup, now time.Time) (string, []quotaCheck, bool) {
+	accounts, err := store.ListServiceAccounts(lg.ServiceAccountDir)
+	if err != nil {
+		log.Printf("rule %s: list service accounts: %v", w.rule.ID, err)
+		return "", nil, false
+	}
+	since := lg.QuotaPeriods(now)[0].Since
+	best, bestUsage := "", int64(-1)
+	for _, sa := range accounts {
+		if w.quotaPaused(ctx, store.ServiceAccountScope(lg.Name, sa), now) {
+			continue
+		}
+		usage, err := w.st.ServiceAccountBudgetSince(ctx, lg.Name, sa, since)
+		if err != nil {
+			log.Printf("rule %s: check service account %s usage: %v", w.rule.ID, sa, err)
+			continue
+		}
+		if lg.ServiceAccountLimitBytes > 0 && usage >= lg.ServiceAccountLimitBytes {
+			continue
+		}
+		if bestUsage < 0 || usage < bestUsage {
+			best, bestUsage = sa, usage
+		}
+	}
+	if best == "" {
+		return "", nil, false
+	}
+	if lg.ServiceAccountLimitBytes <= 0 {
+		return best, nil, true
+	}
+	return best, []quotaCheck{{name: "service account", limit: lg.ServiceAccountLimitBytes, budget: func() (int64, error) {
+		return w.st.ServiceAccountBudgetSince(ctx, lg.Name, best, since)
+	}}}, true
+}
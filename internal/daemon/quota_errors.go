@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"115togd/internal/store"
+)
+
+// providerQuotaRe matches errors in which the provider reports that a quota is used up for the
+// day. Google Drive reports its 750G/day upload limit as "googleapi: Error 403: User rate limit
+// exceeded., userRateLimitExceeded"; the same error is also a short-lived rate limit that rclone
+// retries, which is why only the errors of the last attempt count (see quotaErrorFrom).
+var providerQuotaRe = regexp.MustCompile(`(?i)userRateLimitExceeded|user rate limit exceeded|dailyLimitExceeded|uploadLimitExceeded|quotaExceeded|upload quota exceeded`)
+
+// rcloneAttemptRe matches the line rclone logs when one of its --retries attempts failed.
+var rcloneAttemptRe = regexp.MustCompile(`Attempt (\d+)/(\d+) failed`)
+
+// quotaErrorFrom returns the last error line of the job's final rclone attempt (or the error
+// text) reporting a provider quota error. Errors of earlier attempts are ignored, since the
+// retry got past them.
+func quotaErrorFrom(logPath string, jobErr error) (string, bool) {
+	var found string
+	if f, err := os.Open(logPath); err == nil {
+		sc := bufio.NewScanner(f)
+		buf := make([]byte, 0, 64*1024)
+		sc.Buffer(buf, 1024*1024)
+		retried := false
+		for sc.Scan() {
+			line := sc.Text()
+			if !strings.Contains(line, "ERROR : ") && !strings.Contains(line, "CRITICAL: ") {
+				continue
+			}
+			if strings.Contains(line, "not attempting retries") {
+				// rclone gave up early (e.g. a fatal error with --drive-stop-on-upload-limit): the
+				// attempt it just reported was the last.
+				retried = false
+			}
+			if retried {
+				// A new attempt started; what the previous one hit does not count.
+				found, retried = "", false
+			}
+			if providerQuotaRe.MatchString(line) {
+				found = line
+			}
+			if m := rcloneAttemptRe.FindStringSubmatch(line); m != nil && m[1] != m[2] {
+				retried = true
+			}
+		}
+		_ = f.Close()
+	}
+	if found == "" && jobErr != nil && providerQuotaRe.MatchString(jobErr.Error()) {
+		found = jobErr.Error()
+	}
+	found = strings.TrimSpace(found)
+	if len(found) > 300 {
+		found = found[:300]
+	}
+	return found, found != ""
+}
+
+// pauseForQuota stops new jobs to the destination the failed job wrote to (dstRemote, "" = the
+// rule's own) until the group's next daily reset, or for the configured cooldown when there is none.
+// A job that ran as a service account only pauses that account.
+func (w *ruleWorker) pauseForQuota(ctx context.Context, settings store.RuntimeSettings, dstRemote, account, reason string) {
+	now := time.Now()
+	until := now.Add(settings.QuotaCooldown)
+	scope := store.RuleQuotaScope(w.rule.ID)
+	if w.rule.LimitGroup != "" {
+		scope = store.GroupQuotaScope(w.rule.LimitGroup, dstRemote)
+		if account != "" {
+			scope = store.ServiceAccountScope(w.rule.LimitGroup, account)
+		}
+		if lg, ok, err := w.st.GetLimitGroup(ctx, w.rule.LimitGroup); err == nil && ok {
+			if reset := lg.QuotaPeriods(now)[0].Reset; !reset.IsZero() {
+				until = reset
+			}
+		}
+	}
+	if err := w.st.PauseQuota(ctx, scope, until, reason); err != nil {
+		log.Printf("rule %s: pause %s: %v", w.rule.ID, scope, err)
+		return
+	}
+	log.Printf("rule %s: provider quota exhausted, %s paused until %s: %s", w.rule.ID, scope, until.Format(time.RFC3339), reason)
+}
+
+// quotaPaused reports whether scope is paused after a provider quota error.
+func (w *ruleWorker) quotaPaused(ctx context.Context, scope string, now time.Time) bool {
+	_, ok, err := w.st.QuotaPausedUntil(ctx, scope, now)
+	if err != nil {
+		log.Printf("rule %s: check quota pause: %v", w.rule.ID, err)
+		return false
+	}
+	return ok
+}
@@ -19,54 +19,120 @@ import (
 )
 
 type lsjsonEntry struct {
-	Path    string `json:"Path"`
-	Size    int64  `json:"Size"`
-	ModTime string `json:"ModTime"`
-	IsDir   bool   `json:"IsDir"`
+	Path    string            `json:"Path"`
+	Size    int64             `json:"Size"`
+	ModTime string            `json:"ModTime"`
+	IsDir   bool              `json:"IsDir"`
+	Hashes  map[string]string `json:"Hashes"`
 }
 
-func scanRule(ctx context.Context, rule store.Rule, settings store.RuntimeSettings) ([]store.ScanEntry, error) {
-	var src string
-	if rule.SrcKind == "local" {
-		src = rule.SrcLocalRoot
-	} else {
-		src = fmt.Sprintf("%s:%s", rule.SrcRemote, rule.SrcPath)
+// scanRule lists the rule's whole source, passing every file that passes filter to add.
+func scanRule(ctx context.Context, rule store.Rule, filter *store.FileFilter, settings store.RuntimeSettings, add func(store.ScanEntry) error) error {
+	now := time.Now()
+	return lsjson(ctx, ruleSource(rule), []string{"--recursive", "--files-only"}, settings, func(p string, e lsjsonEntry) error {
+		if entry, ok := scanEntry(p, e, filter, now); ok {
+			return add(entry)
+		}
+		return nil
+	})
+}
+
+// lsjsonFiles lists all files below target that pass the rule's filter (nil = all files).
+func lsjsonFiles(ctx context.Context, target string, filter *store.FileFilter, settings store.RuntimeSettings) ([]store.ScanEntry, error) {
+	now := time.Now()
+	var out []store.ScanEntry
+	err := lsjson(ctx, target, []string{"--recursive", "--files-only"}, settings, func(p string, e lsjsonEntry) error {
+		if entry, ok := scanEntry(p, e, filter, now); ok {
+			out = append(out, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	args := []string{"lsjson", src, "--recursive", "--files-only"}
+	return out, nil
+}
+
+// scanEntry converts a listed file into a scan entry; ok is false when the filter drops it.
+func scanEntry(p string, e lsjsonEntry, filter *store.FileFilter, now time.Time) (store.ScanEntry, bool) {
+	mt, err := time.Parse(time.RFC3339Nano, e.ModTime)
+	if err != nil {
+		mt, err = time.Parse(time.RFC3339, e.ModTime)
+	}
+	if err != nil {
+		mt = time.Now()
+	}
+	if !filter.Match(p, e.Size, mt, now) {
+		return store.ScanEntry{}, false
+	}
+	return store.ScanEntry{
+		Path:    p,
+		Size:    e.Size,
+		ModTime: mt,
+	}, true
+}
+
+// lsjson runs rclone lsjson over target with flags and calls fn for every entry (directories
+// too, unless flags say --files-only), with its path relative to target in slash form. Entries
+// are decoded straight from rclone's output as it lists, so nothing is buffered; an error from
+// fn stops the listing.
+func lsjson(ctx context.Context, target string, flags []string, settings store.RuntimeSettings, fn func(p string, e lsjsonEntry) error) error {
+	args := append([]string{"lsjson", target}, flags...)
 	if strings.TrimSpace(settings.RcloneConfigPath) != "" {
 		args = append(args, "--config", settings.RcloneConfigPath)
 	}
 	cmd := exec.CommandContext(ctx, "rclone", args...)
-	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
-	if err := cmd.Run(); err != nil {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("rclone lsjson: %w", err)
+	}
+
+	var fnErr error
+	readErr := readLsjson(stdout, func(p string, e lsjsonEntry) bool {
+		fnErr = fn(p, e)
+		return fnErr == nil
+	})
+	if readErr != nil || fnErr != nil {
+		_ = cmd.Process.Kill()
+	}
+	_, _ = io.Copy(io.Discard, stdout)
+	waitErr := cmd.Wait()
+	switch {
+	case fnErr != nil:
+		return fnErr
+	case waitErr != nil && (readErr == nil || stderr.Len() > 0):
 		msg := strings.TrimSpace(stderr.String())
 		if msg == "" {
-			msg = err.Error()
+			msg = waitErr.Error()
 		}
-		return nil, fmt.Errorf("rclone lsjson: %s", msg)
+		return fmt.Errorf("rclone lsjson: %s", msg)
 	}
+	return readErr
+}
 
-	dec := json.NewDecoder(bytes.NewReader(stdout.Bytes()))
+// readLsjson decodes the JSON array lsjson writes, calling fn for every entry until it returns false.
+func readLsjson(r io.Reader, fn func(p string, e lsjsonEntry) bool) error {
+	dec := json.NewDecoder(r)
 	tok, err := dec.Token()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	delim, ok := tok.(json.Delim)
 	if !ok || delim != '[' {
-		return nil, errors.New("unexpected lsjson output")
+		return errors.New("unexpected lsjson output")
 	}
 
-	ignoreExts := store.ParseIgnoreExtensions(rule.IgnoreExtensions)
-	var out []store.ScanEntry
 	for dec.More() {
 		var e lsjsonEntry
 		if err := dec.Decode(&e); err != nil {
-			return nil, err
+			return err
 		}
-		if e.IsDir || e.Path == "" {
+		if e.Path == "" {
 			continue
 		}
 		p := strings.TrimLeft(e.Path, "/\\")
@@ -74,34 +140,12 @@ func scanRule(ctx context.Context, rule store.Rule, settings store.RuntimeSettin
 		if p == "" {
 			continue
 		}
-		if len(ignoreExts) > 0 {
-			lp := strings.ToLower(p)
-			ignored := false
-			for _, ext := range ignoreExts {
-				if strings.HasSuffix(lp, ext) {
-					ignored = true
-					break
-				}
-			}
-			if ignored {
-				continue
-			}
+		if !fn(p, e) {
+			return nil
 		}
-		mt, err := time.Parse(time.RFC3339Nano, e.ModTime)
-		if err != nil {
-			mt, err = time.Parse(time.RFC3339, e.ModTime)
-		}
-		if err != nil {
-			mt = time.Now()
-		}
-		out = append(out, store.ScanEntry{
-			Path:    p,
-			Size:    e.Size,
-			ModTime: mt,
-		})
 	}
-	_, _ = dec.Token()
-	return out, nil
+	_, err = dec.Token()
+	return err
 }
 
 type rcStats struct {
@@ -152,6 +196,23 @@ func pollRC(ctx context.Context, port int) (rcStats, error) {
 	}, nil
 }
 
+// setRCBwlimit changes the bandwidth limit of a running rclone through its rc endpoint ("off" lifts it).
+func setRCBwlimit(ctx context.Context, port int, rate string) error {
+	body, _ := json.Marshal(map[string]string{"rate": rate})
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/core/bwlimit", port), bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := (&http.Client{Timeout: 2 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("rc status %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
 func toInt64(v any) int64 {
 	switch t := v.(type) {
 	case float64:
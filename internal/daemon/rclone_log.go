@@ -3,7 +3,10 @@ package daemon
 import (
 	"bufio"
 	"os"
+	"regexp"
 	"strings"
+
+	"115togd/internal/store"
 )
 
 func logHadNothingToTransfer(logPath string) bool {
@@ -77,3 +80,68 @@ func transferredPathsFromLog(logPath string) (map[string]struct{}, error) {
 	}
 	return done, nil
 }
+
+// permanentFileErrorRe matches per-file rclone errors that will fail the same way on every
+// attempt: names or sizes the destination refuses, and source files that are gone or unreadable.
+var permanentFileErrorRe = regexp.MustCompile(`(?i)file name too long|name too long|filename too long|invalid (file ?)?name|illegal character|file too large|exceeds the maximum|maximum file size|fileSizeLimitExceeded|cannotDownloadAbusiveFile|permission denied|no such file or directory|object not found|file not found|not a regular file`)
+
+// isPermanentFileError reports whether retrying a file that failed with reason is pointless.
+func isPermanentFileError(reason string) bool {
+	return permanentFileErrorRe.MatchString(reason)
+}
+
+// parseFileErrorLine splits an rclone error line about one of the job's files,
+// "2025/12/25 14:45:20 ERROR : path/to/file: reason", into the path and the reason. Paths are
+// matched against known, so a ": " inside a file name does not cut it short.
+func parseFileErrorLine(line string, known map[string]struct{}) (string, string, bool) {
+	i := strings.Index(line, "ERROR : ")
+	if i < 0 {
+		return "", "", false
+	}
+	rest := line[i+len("ERROR : "):]
+	for j := strings.Index(rest, ": "); j >= 0; {
+		p := strings.ReplaceAll(strings.TrimSpace(rest[:j]), "\\", "/")
+		if _, ok := known[p]; ok {
+			return p, strings.TrimSpace(rest[j+2:]), true
+		}
+		k := strings.Index(rest[j+2:], ": ")
+		if k < 0 {
+			break
+		}
+		j += 2 + k
+	}
+	return "", "", false
+}
+
+// fileErrorsFromLog returns the last error rclone logged for each of paths that it failed,
+// classified as permanent or transient.
+func fileErrorsFromLog(logPath string, paths []string) (map[string]store.FileError, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	known := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		known[p] = struct{}{}
+	}
+	out := map[string]store.FileError{}
+	sc := bufio.NewScanner(f)
+	buf := make([]byte, 0, 64*1024)
+	sc.Buffer(buf, 1024*1024)
+	for sc.Scan() {
+		p, reason, ok := parseFileErrorLine(sc.Text(), known)
+		if !ok {
+			continue
+		}
+		if len(reason) > 300 {
+			reason = reason[:300]
+		}
+		out[p] = store.FileError{Reason: reason, Permanent: isPermanentFileError(reason)}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
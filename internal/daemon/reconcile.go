@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"115togd/internal/store"
+)
+
+// maybeReconcileDest reconciles rule with its destination when asked to from the UI, or once
+// after the first scan of a rule that seeds its state from the destination. Only a requested
+// run re-queues done files the destination lost; the automatic one just skips what is there.
+func (w *ruleWorker) maybeReconcileDest(ctx context.Context, settings store.RuntimeSettings, rule store.Rule, requested bool) {
+	if !rule.CanReconcileDest() {
+		return
+	}
+	if !requested {
+		if !rule.SeedFromDest {
+			return
+		}
+		if last, ok, err := w.st.GetDestReconcile(ctx, rule.ID); err != nil || (ok && last.Error == "") {
+			return
+		}
+	}
+	dest, err := listDest(ctx, rule, settings)
+	if err != nil {
+		log.Printf("rule %s: reconcile destination: %v", rule.ID, err)
+		_ = w.st.RecordDestReconcileError(ctx, rule.ID, err.Error())
+		return
+	}
+	res, err := w.st.ReconcileDest(ctx, rule, dest, requested)
+	if err != nil {
+		log.Printf("rule %s: reconcile destination: %v", rule.ID, err)
+		_ = w.st.RecordDestReconcileError(ctx, rule.ID, err.Error())
+		return
+	}
+	log.Printf("rule %s: reconciled with %d destination files: %d seeded as done, %d re-queued", rule.ID, res.DestFiles, res.Seeded, res.Requeued)
+}
+
+// listDest lists the rule's destination by path. For remote sources both sides are listed with
+// hashes: files whose hashes differ are left out, those whose hashes match are marked so. Local
+// sources are compared by size only, since hashing them would read every file.
+func listDest(ctx context.Context, rule store.Rule, settings store.RuntimeSettings) (map[string]store.DestFile, error) {
+	flags := []string{"--recursive", "--files-only"}
+	if rule.SrcKind != "local" {
+		flags = append(flags, "--hash")
+	}
+	dest := map[string]store.DestFile{}
+	hashes := map[string]map[string]string{}
+	err := lsjson(ctx, ruleDest(rule), flags, settings, func(p string, e lsjsonEntry) error {
+		dest[p] = store.DestFile{Size: e.Size}
+		if len(e.Hashes) > 0 {
+			hashes[p] = e.Hashes
+		}
+		return nil
+	})
+	if err != nil && strings.Contains(err.Error(), "directory not found") {
+		// Nothing was copied yet.
+		return map[string]store.DestFile{}, nil
+	}
+	if err != nil || len(hashes) == 0 {
+		return dest, err
+	}
+	err = lsjson(ctx, ruleSource(rule), flags, settings, func(p string, e lsjsonEntry) error {
+		dh, ok := hashes[p]
+		switch {
+		case !ok:
+		case hashesDiffer(e.Hashes, dh):
+			delete(dest, p)
+		case hashesMatch(e.Hashes, dh):
+			d := dest[p]
+			d.HashMatched = true
+			dest[p] = d
+		}
+		return nil
+	})
+	return dest, err
+}
+
+// hashesDiffer reports whether a and b have a hash type in common with different values.
+func hashesDiffer(a, b map[string]string) bool {
+	for t, v := range a {
+		if w := b[t]; v != "" && w != "" && v != w {
+			return true
+		}
+	}
+	return false
+}
+
+// hashesMatch reports whether a and b have a hash type in common with the same value.
+func hashesMatch(a, b map[string]string) bool {
+	for t, v := range a {
+		if v != "" && b[t] == v {
+			return true
+		}
+	}
+	return false
+}
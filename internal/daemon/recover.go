@@ -12,12 +12,13 @@ func RecoverDanglingRuns(ctx context.Context, st *store.Store) error {
 	// so we mark them as failed and re-queue transferring files.
 	type row struct {
 		JobID   string
+		RuleID  string
 		LogPath string
 	}
 	var running []row
 
 	rows, err := st.DB().QueryContext(ctx, `
-SELECT job_id, log_path
+SELECT job_id, rule_id, log_path
 FROM jobs
 WHERE status='running'
 `)
@@ -26,7 +27,7 @@ WHERE status='running'
 	}
 	for rows.Next() {
 		var r row
-		if err := rows.Scan(&r.JobID, &r.LogPath); err != nil {
+		if err := rows.Scan(&r.JobID, &r.RuleID, &r.LogPath); err != nil {
 			_ = rows.Close()
 			return err
 		}
@@ -74,6 +75,11 @@ WHERE job_id=? AND state='transferring'
 			}
 		}
 		_ = st.FinalizeJobFiles(ctx, j.JobID, donePaths, "queued", "")
+		if rule, ok, err := st.GetRule(ctx, j.RuleID); err == nil && ok {
+			if _, err := st.FeedDownstream(ctx, rule, j.JobID); err != nil {
+				log.Printf("rule %s: feed downstream: %v", rule.ID, err)
+			}
+		}
 		_ = st.ClearJobOnDone(ctx, j.JobID)
 	}
 
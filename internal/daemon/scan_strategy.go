@@ -0,0 +1,120 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+
+	"115togd/internal/store"
+)
+
+// watchFullScanInterval is how often a watched local source is listed in full when the rule
+// sets no full scan interval; the watcher keeps the files up to date in between.
+const watchFullScanInterval = 6 * time.Hour
+
+// fullScanDue reports whether this scan has to list the whole source: always for the full
+// strategy (unless a watcher follows the source), for scans requested from the UI, for the
+// worker's first scan and once the rule's full scan interval passed since the last full scan.
+func (w *ruleWorker) fullScanDue(now time.Time, forced bool) bool {
+	if forced {
+		return true
+	}
+	interval := time.Duration(w.rule.FullScanIntervalSec) * time.Second
+	if w.watching.Load() {
+		if interval <= 0 {
+			interval = watchFullScanInterval
+		}
+	} else if w.rule.ScanStrategy == "full" {
+		return true
+	}
+	last := w.lastScanAt.Load()
+	return last == 0 || now.Sub(time.Unix(last, 0)) >= interval
+}
+
+// listSource lists the rule's source for a scan, passing the files to add as they are listed.
+// An incremental listing (full = false) only covers files that may have changed; it must not be
+// used to tell which files disappeared.
+func (w *ruleWorker) listSource(ctx context.Context, filter *store.FileFilter, settings store.RuntimeSettings, full bool, add func(store.ScanEntry) error) error {
+	switch {
+	case w.rule.ScanStrategy == "dirs":
+		return w.listDirs(ctx, filter, settings, full, add)
+	case full:
+		return scanRule(ctx, w.rule, filter, settings, add)
+	default:
+		return w.listRecent(ctx, filter, settings, add)
+	}
+}
+
+// listRecent lists the files modified since the last scan. The window reaches back a minute and
+// the rule's stable time further, so files still settling at the last scan are listed again
+// and can become stable.
+func (w *ruleWorker) listRecent(ctx context.Context, filter *store.FileFilter, settings store.RuntimeSettings, add func(store.ScanEntry) error) error {
+	since := time.Unix(w.lastListAt.Load(), 0).Add(-time.Minute - time.Duration(w.rule.StableSeconds)*time.Second)
+	maxAge := fmt.Sprintf("%ds", int64(time.Since(since).Seconds())+1)
+	now := time.Now()
+	return lsjson(ctx, ruleSource(w.rule), []string{"--recursive", "--files-only", "--max-age", maxAge}, settings, func(p string, e lsjsonEntry) error {
+		if entry, ok := scanEntry(p, e, filter, now); ok {
+			return add(entry)
+		}
+		return nil
+	})
+}
+
+// listDirs lists the source for the dirs strategy. A full scan lists the whole tree recursively
+// and records every directory's modification time; an incremental one walks the tree level by
+// level and skips the subtrees of directories whose modification time did not change. That
+// only finds everything on remotes that update a directory when something below it changes;
+// the periodic full scan catches the rest.
+func (w *ruleWorker) listDirs(ctx context.Context, filter *store.FileFilter, settings store.RuntimeSettings, full bool, add func(store.ScanEntry) error) error {
+	now := time.Now()
+	dirs := map[string]string{}
+	list := func(p string, e lsjsonEntry) error {
+		if e.IsDir {
+			dirs[p] = e.ModTime
+		} else if entry, ok := scanEntry(p, e, filter, now); ok {
+			return add(entry)
+		}
+		return nil
+	}
+	if full {
+		if err := lsjson(ctx, ruleSource(w.rule), []string{"--recursive"}, settings, list); err != nil {
+			return err
+		}
+		return w.st.SaveScanDirs(ctx, w.rule.ID, dirs, true)
+	}
+	known, err := w.st.ScanDirs(ctx, w.rule.ID)
+	if err != nil {
+		return err
+	}
+	pending := []string{""}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+		var sub []string
+		err := lsjson(ctx, sourceDir(w.rule, dir), nil, settings, func(p string, e lsjsonEntry) error {
+			p = path.Join(dir, p)
+			if mt, ok := known[p]; e.IsDir && (!ok || mt != e.ModTime) {
+				sub = append(sub, p)
+			}
+			return list(p, e)
+		})
+		if err != nil {
+			return err
+		}
+		pending = append(pending, sub...)
+	}
+	return w.st.SaveScanDirs(ctx, w.rule.ID, dirs, false)
+}
+
+// sourceDir returns the rclone target of a directory below the rule's source ("" = the source).
+func sourceDir(rule store.Rule, dir string) string {
+	if dir == "" {
+		return ruleSource(rule)
+	}
+	if rule.SrcKind == "local" {
+		return filepath.Join(rule.SrcLocalRoot, filepath.FromSlash(dir))
+	}
+	return fmt.Sprintf("%s:%s", rule.SrcRemote, path.Join(rule.SrcPath, dir))
+}
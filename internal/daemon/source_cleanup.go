@@ -0,0 +1,204 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"115togd/internal/store"
+)
+
+// cleanupSource deletes the source copy of files a copy rule transferred long enough ago, then,
+// for local sources over the disk watermark, the longest transferred ones until the disk is
+// below it again. Moving files to a trash directory on the source's own file system frees no
+// space, so the watermark is not enforced then.
+func (w *ruleWorker) cleanupSource(ctx context.Context, settings store.RuntimeSettings) {
+	rule := w.rule
+	if rule.ParentID != "" || rule.TransferMode != "copy" || !rule.SourceCleanup() {
+		return
+	}
+	if rule.SourceDeleteAfterDays > 0 {
+		before := time.Now().Add(-time.Duration(rule.SourceDeleteAfterDays) * 24 * time.Hour)
+		files, err := w.st.SourceCleanupCandidates(ctx, rule, before, 0)
+		if err != nil {
+			log.Printf("rule %s: source cleanup: %v", rule.ID, err)
+			return
+		}
+		w.deleteSourceFiles(ctx, settings, files, "age")
+	}
+	if rule.SourceDeleteWatermark > 0 && rule.SrcKind == "local" {
+		if rule.SourceTrashDir != "" {
+			same, err := sameFileSystem(rule.SrcLocalRoot, rule.SourceTrashDir)
+			if err != nil {
+				log.Printf("rule %s: source trash dir: %v", rule.ID, err)
+				return
+			}
+			if same {
+				log.Printf("rule %s: source trash dir is on the source disk, skipping watermark cleanup", rule.ID)
+				return
+			}
+		}
+		total, used, err := diskUsage(rule.SrcLocalRoot)
+		if err != nil {
+			log.Printf("rule %s: source disk usage: %v", rule.ID, err)
+			return
+		}
+		limit := total / 100 * uint64(rule.SourceDeleteWatermark)
+		if used <= limit {
+			return
+		}
+		need := int64(used - limit)
+		files, err := w.st.SourceCleanupCandidates(ctx, rule, time.Time{}, 0)
+		if err != nil {
+			log.Printf("rule %s: source cleanup: %v", rule.ID, err)
+			return
+		}
+		var pick []store.SourceFile
+		for _, f := range files {
+			if need <= 0 {
+				break
+			}
+			pick = append(pick, f)
+			need -= f.Size
+		}
+		w.deleteSourceFiles(ctx, settings, pick, "watermark")
+	}
+}
+
+// deleteSourceFiles removes (or moves to the trash directory) the source copy of files and
+// records every attempt.
+func (w *ruleWorker) deleteSourceFiles(ctx context.Context, settings store.RuntimeSettings, files []store.SourceFile, reason string) {
+	if len(files) == 0 {
+		return
+	}
+	results := make([]store.SourceDeletion, len(files))
+	for i, f := range files {
+		results[i] = store.SourceDeletion{RuleID: w.rule.ID, Path: f.Path, Size: f.Size, Reason: reason}
+	}
+	if w.rule.SrcKind == "local" {
+		for i := range results {
+			results[i].TrashPath, results[i].Error = w.removeLocalSource(results[i].Path, results[i].Size)
+		}
+	} else if err := w.deleteRemoteSource(ctx, settings, files); err != nil {
+		for i := range results {
+			results[i].Error = err.Error()
+		}
+	}
+	var deleted int
+	for _, d := range results {
+		d.At = time.Now()
+		if d.Error == "" {
+			deleted++
+		}
+		if err := w.st.RecordSourceDeletion(ctx, d); err != nil {
+			log.Printf("rule %s: record source deletion: %v", w.rule.ID, err)
+		}
+	}
+	log.Printf("rule %s: cleaned up %d/%d source files (%s)", w.rule.ID, deleted, len(files), reason)
+}
+
+// removeLocalSource deletes one local source file, or moves it below the trash directory. A
+// file whose size changed since it was transferred is left alone.
+func (w *ruleWorker) removeLocalSource(p string, size int64) (trashPath, errMsg string) {
+	full := filepath.Join(w.rule.SrcLocalRoot, filepath.FromSlash(p))
+	fi, err := os.Stat(full)
+	if err != nil {
+		return "", err.Error()
+	}
+	if fi.Size() != size {
+		return "", fmt.Sprintf("size changed since transfer (%d != %d)", fi.Size(), size)
+	}
+	if w.rule.SourceTrashDir == "" {
+		if err := os.Remove(full); err != nil {
+			return "", err.Error()
+		}
+		return "", ""
+	}
+	trashPath = filepath.Join(w.rule.SourceTrashDir, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(trashPath), 0o755); err != nil {
+		return "", err.Error()
+	}
+	if err := moveFile(full, trashPath); err != nil {
+		return "", err.Error()
+	}
+	return trashPath, ""
+}
+
+// moveFile renames src to dst, copying and then removing src when dst is on another file system.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	_ = os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+	return os.Remove(src)
+}
+
+// deleteRemoteSource deletes the source copy of files with one rclone delete call.
+func (w *ruleWorker) deleteRemoteSource(ctx context.Context, settings store.RuntimeSettings, files []store.SourceFile) error {
+	list, err := os.CreateTemp("", "115togd-cleanup-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(list.Name())
+	for _, f := range files {
+		if _, err := fmt.Fprintln(list, f.Path); err != nil {
+			_ = list.Close()
+			return err
+		}
+	}
+	if err := list.Close(); err != nil {
+		return err
+	}
+	args := []string{"delete", ruleSource(w.rule), "--files-from-raw", list.Name()}
+	if strings.TrimSpace(settings.RcloneConfigPath) != "" {
+		args = append(args, "--config", settings.RcloneConfigPath)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return errors.New("rclone delete: " + msg)
+	}
+	return nil
+}
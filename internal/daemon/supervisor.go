@@ -17,6 +17,7 @@ type Supervisor struct {
 	workers map[string]*ruleWorker
 
 	globalLimiter *GlobalLimiter
+	globalBwlimit *globalBwlimit
 	portManager   *PortManager
 	jobs          *JobRegistry
 
@@ -28,6 +29,7 @@ func NewSupervisor(st *store.Store) *Supervisor {
 		st:            st,
 		workers:       map[string]*ruleWorker{},
 		globalLimiter: NewGlobalLimiter(0),
+		globalBwlimit: &globalBwlimit{},
 		portManager:   NewPortManager(55720, 55800),
 		jobs:          NewJobRegistry(),
 	}
@@ -59,6 +61,7 @@ func (s *Supervisor) refreshRuntime(ctx context.Context) {
 		return
 	}
 	s.globalLimiter.SetLimit(rs.GlobalMaxJobs)
+	s.globalBwlimit.Set(rs.Bwlimit)
 	s.portManager.SetRange(rs.RcPortStart, rs.RcPortEnd)
 }
 
@@ -72,7 +75,7 @@ func (s *Supervisor) stopAll() {
 }
 
 func (s *Supervisor) reconcile(ctx context.Context) {
-	rules, err := s.st.ListRules(ctx)
+	rules, err := s.st.ListRulesWithReplicas(ctx)
 	if err != nil {
 		log.Printf("supervisor: list rules: %v", err)
 		return
@@ -104,7 +107,7 @@ func (s *Supervisor) reconcile(ctx context.Context) {
 		if _, ok := s.workers[id]; ok {
 			continue
 		}
-		w := newRuleWorker(s.st, r, s.portManager, s.globalLimiter, s.jobs)
+		w := newRuleWorker(s.st, r, s.portManager, s.globalLimiter, s.globalBwlimit, s.jobs)
 		s.workers[id] = w
 		go w.run(ctx)
 	}
@@ -112,6 +115,8 @@ func (s *Supervisor) reconcile(ctx context.Context) {
 
 func ruleSame(a, b store.Rule) bool {
 	return a.ID == b.ID &&
+		a.ParentID == b.ParentID &&
+		a.UpstreamRule == b.UpstreamRule &&
 		a.LimitGroup == b.LimitGroup &&
 		a.SrcKind == b.SrcKind &&
 		a.SrcRemote == b.SrcRemote &&
@@ -121,8 +126,16 @@ func ruleSame(a, b store.Rule) bool {
 		a.DstRemote == b.DstRemote &&
 		a.DstPath == b.DstPath &&
 		a.TransferMode == b.TransferMode &&
+		a.MaxDelete == b.MaxDelete &&
+		a.ConflictPolicy == b.ConflictPolicy &&
+		a.VerifyMode == b.VerifyMode &&
 		a.RcloneExtraArgs == b.RcloneExtraArgs &&
 		a.IgnoreExtensions == b.IgnoreExtensions &&
+		a.Filters == b.Filters &&
+		a.JobSchedule == b.JobSchedule &&
+		a.ScanSchedule == b.ScanSchedule &&
+		a.WindowPolicy == b.WindowPolicy &&
+		a.WindowBwlimit == b.WindowBwlimit &&
 		a.Bwlimit == b.Bwlimit &&
 		a.DailyLimitBytes == b.DailyLimitBytes &&
 		a.MinFileSizeBytes == b.MinFileSizeBytes &&
@@ -131,6 +144,17 @@ func ruleSame(a, b store.Rule) bool {
 		a.ScanIntervalSec == b.ScanIntervalSec &&
 		a.StableSeconds == b.StableSeconds &&
 		a.BatchSize == b.BatchSize &&
+		a.BatchMaxBytes == b.BatchMaxBytes &&
+		a.QueueOrder == b.QueueOrder &&
+		a.MissingAction == b.MissingAction &&
+		a.MissingGraceScans == b.MissingGraceScans &&
+		a.SourceDeleteAfterDays == b.SourceDeleteAfterDays &&
+		a.SourceDeleteWatermark == b.SourceDeleteWatermark &&
+		a.SourceTrashDir == b.SourceTrashDir &&
+		a.SeedFromDest == b.SeedFromDest &&
+		a.ScanStrategy == b.ScanStrategy &&
+		a.FullScanIntervalSec == b.FullScanIntervalSec &&
+		a.PriorityRules == b.PriorityRules &&
 		a.Enabled == b.Enabled
 }
 
@@ -141,6 +165,22 @@ func (s *Supervisor) TriggerScan(ruleID string) bool {
 	if !ok {
 		return false
 	}
+	w.forceScan.Store(true)
+	w.triggerScan()
+	return true
+}
+
+// ReconcileDest runs a scan of the rule that also reconciles its files (and its replicas') with
+// the destination.
+func (s *Supervisor) ReconcileDest(ruleID string) bool {
+	s.mu.Lock()
+	w, ok := s.workers[ruleID]
+	s.mu.Unlock()
+	if !ok {
+		return false
+	}
+	w.reconcileDest.Store(true)
+	w.forceScan.Store(true)
 	w.triggerScan()
 	return true
 }
@@ -196,8 +236,8 @@ func (s *Supervisor) runManualJob(ctx context.Context, rule store.Rule, jobID st
 
 	_ = s.st.UpdateJobRunning(ctx, jobID, port)
 
-	w := &ruleWorker{st: s.st, rule: rule, jr: s.jobs}
-	res := w.runWithMetrics(ctx, settings, port, "", logPath, jobID)
+	w := &ruleWorker{st: s.st, rule: rule, jr: s.jobs, bwlimit: s.globalBwlimit}
+	res := w.runWithMetrics(ctx, settings, port, "", "", "", "", logPath, jobID)
 	if res.Err != nil {
 		if errors.Is(res.Err, errTerminatedByUser) {
 			_ = s.st.UpdateJobTerminated(ctx, jobID, "terminated by user", res.BytesDone, res.AvgSpeed)
@@ -0,0 +1,207 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"115togd/internal/store"
+)
+
+// verifyJob checks the files a job transferred against the destination (rule.VerifyMode).
+// copy/sync rules use `rclone check` against the source; move rules, whose source is gone,
+// compare the destination size with the size recorded at scan time. The destination is opened
+// as the service account the job ran as (accountFile), if any. rclone check logs to verify.log
+// in jobDir, apart from the transfer log that the job's outcome is parsed from.
+// A job cut short by shutdown (ctx done) is not verified; its done files stay unverified.
+func (w *ruleWorker) verifyJob(ctx context.Context, settings store.RuntimeSettings, dstRemote, accountFile string, batches []store.ClaimedBatch, jobDir, jobID string) {
+	if w.rule.VerifyMode == "" || ctx.Err() != nil {
+		return
+	}
+	sizes, err := w.st.JobDoneFileSizes(ctx, jobID)
+	if err != nil {
+		log.Printf("rule %s: verify %s: %v", w.rule.ID, jobID, err)
+		return
+	}
+	if len(sizes) == 0 {
+		return
+	}
+	var verified []string
+	var failed []store.JobVerifyFailure
+	for i, b := range batches {
+		var paths []string
+		for _, p := range b.Paths {
+			if _, ok := sizes[p]; ok {
+				paths = append(paths, p)
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		listPath := filepath.Join(jobDir, fmt.Sprintf("verify-%d.txt", i+1))
+		if err := os.WriteFile(listPath, []byte(strings.Join(paths, "\n")+"\n"), 0o600); err != nil {
+			_ = w.st.RecordJobVerifyError(ctx, jobID, err.Error())
+			return
+		}
+		dstRule := w.rule
+		if dstRemote != "" {
+			dstRule.DstRemote = dstRemote
+		}
+		dstRule.DstPath = b.DstPath
+		var ok []string
+		var bad []store.JobVerifyFailure
+		if w.rule.TransferMode == "move" {
+			ok, bad, err = w.verifyDstSizes(ctx, settings, ruleDest(dstRule), accountFile, listPath, paths, sizes)
+		} else {
+			ok, bad, err = w.verifyCheck(ctx, settings, ruleDest(dstRule), accountFile, listPath, filepath.Join(jobDir, fmt.Sprintf("check-%d.txt", i+1)), filepath.Join(jobDir, "verify.log"))
+		}
+		if err != nil {
+			log.Printf("rule %s: verify %s: %v", w.rule.ID, jobID, err)
+			_ = w.st.RecordJobVerifyError(ctx, jobID, err.Error())
+			return
+		}
+		verified = append(verified, ok...)
+		for _, f := range bad {
+			f.JobID = jobID
+			failed = append(failed, f)
+		}
+	}
+	if len(failed) > 0 {
+		log.Printf("rule %s: job %s: %d file(s) failed verification", w.rule.ID, jobID, len(failed))
+	}
+	if err := w.st.RecordJobVerify(ctx, jobID, verified, failed); err != nil {
+		log.Printf("rule %s: record verify %s: %v", w.rule.ID, jobID, err)
+	}
+}
+
+// verifyCheck runs `rclone check --one-way` for the listed paths and reads its --combined report.
+func (w *ruleWorker) verifyCheck(ctx context.Context, settings store.RuntimeSettings, dst, accountFile, listPath, reportPath, logPath string) ([]string, []store.JobVerifyFailure, error) {
+	args := []string{"check", ruleSource(w.rule), dst,
+		"--one-way",
+		"--files-from-raw", listPath,
+		"--combined", reportPath,
+		"--log-file", logPath,
+		"--log-level", "INFO",
+		fmt.Sprintf("--checkers=%d", settings.Checkers),
+	}
+	if w.rule.VerifyMode == "size" {
+		args = append(args, "--size-only")
+	}
+	if strings.TrimSpace(settings.RcloneConfigPath) != "" {
+		args = append(args, "--config", settings.RcloneConfigPath)
+	}
+	if accountFile != "" {
+		args = append(args, "--drive-service-account-file", accountFile)
+	}
+	extra, err := w.extraArgs(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	args = append(args, extra...)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	cmd.Stderr = &stderr
+	// check exits non-zero when it finds differences; the report tells them apart from real errors.
+	runErr := cmd.Run()
+
+	f, err := os.Open(reportPath)
+	if err != nil {
+		if runErr != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = runErr.Error()
+			}
+			return nil, nil, fmt.Errorf("rclone check: %s", msg)
+		}
+		return nil, nil, err
+	}
+	defer f.Close()
+	var ok []string
+	var bad []store.JobVerifyFailure
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		if len(line) < 3 || line[1] != ' ' {
+			continue
+		}
+		p := line[2:]
+		switch line[0] {
+		case '=':
+			ok = append(ok, p)
+		case '-':
+			bad = append(bad, store.JobVerifyFailure{Path: p, Reason: "missing at destination"})
+		case '*':
+			reason := "checksum differs"
+			if w.rule.VerifyMode == "size" {
+				reason = "size differs"
+			}
+			bad = append(bad, store.JobVerifyFailure{Path: p, Reason: reason})
+		case '!':
+			bad = append(bad, store.JobVerifyFailure{Path: p, Reason: "check error"})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	if runErr != nil && len(ok) == 0 && len(bad) == 0 {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = runErr.Error()
+		}
+		return nil, nil, fmt.Errorf("rclone check: %s", msg)
+	}
+	return ok, bad, nil
+}
+
+// verifyDstSizes lists the paths at the destination and compares their sizes with the recorded ones.
+func (w *ruleWorker) verifyDstSizes(ctx context.Context, settings store.RuntimeSettings, dst, accountFile, listPath string, paths []string, sizes map[string]int64) ([]string, []store.JobVerifyFailure, error) {
+	args := []string{"lsjson", dst, "--recursive", "--files-only", "--no-modtime", "--no-mimetype", "--files-from-raw", listPath}
+	if strings.TrimSpace(settings.RcloneConfigPath) != "" {
+		args = append(args, "--config", settings.RcloneConfigPath)
+	}
+	if accountFile != "" {
+		args = append(args, "--drive-service-account-file", accountFile)
+	}
+	cmd := exec.CommandContext(ctx, "rclone", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, nil, fmt.Errorf("rclone lsjson: %s", msg)
+	}
+	var entries []lsjsonEntry
+	if err := json.Unmarshal(stdout.Bytes(), &entries); err != nil {
+		return nil, nil, err
+	}
+	got := map[string]int64{}
+	for _, e := range entries {
+		got[strings.TrimLeft(e.Path, "/")] = e.Size
+	}
+	var ok []string
+	var bad []store.JobVerifyFailure
+	for _, p := range paths {
+		n, found := got[p]
+		switch {
+		case !found:
+			bad = append(bad, store.JobVerifyFailure{Path: p, Reason: "missing at destination"})
+		case n != sizes[p]:
+			bad = append(bad, store.JobVerifyFailure{Path: p, Reason: fmt.Sprintf("size differs (%d != %d)", n, sizes[p])})
+		default:
+			ok = append(ok, p)
+		}
+	}
+	return ok, bad, nil
+}
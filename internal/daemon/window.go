@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"115togd/internal/store"
+)
+
+// windowClosed reports whether a running job has to stop because its rule's job window closed
+// and the rule's window_policy is terminate.
+func (w *ruleWorker) windowClosed(jobID string) bool {
+	if w.rule.WindowPolicy != "terminate" || w.jobWindow.Active(time.Now()) {
+		return false
+	}
+	log.Printf("rule %s: job window closed, terminating job %s", w.rule.ID, jobID)
+	return true
+}
+
+// jobBwlimit is the rate a job of this rule should run with at now: the window rate while a
+// throttle-policy window is closed, else the rule's or global bwlimit (timetables resolved);
+// "off" when nothing limits it.
+func (w *ruleWorker) jobBwlimit(settings store.RuntimeSettings, now time.Time) string {
+	if w.rule.WindowPolicy == "throttle" && !w.jobWindow.Active(now) {
+		return w.rule.WindowBwlimit
+	}
+	if rate := store.EffectiveBwlimit(w.rule.Bwlimit, settings.Bwlimit, now); rate != "" {
+		return rate
+	}
+	return "off"
+}
+
+// globalBwlimit is the global bwlimit setting as last loaded by the supervisor, so running jobs
+// pick up changes to it without reading the settings themselves.
+type globalBwlimit struct {
+	v atomic.Value // string
+}
+
+func (g *globalBwlimit) Set(rate string) { g.v.Store(rate) }
+
+func (g *globalBwlimit) Get() (string, bool) {
+	if g == nil {
+		return "", false
+	}
+	rate, ok := g.v.Load().(string)
+	return rate, ok
+}
+
+// applyBwlimit pushes the current jobBwlimit into a running job over rc when it differs from
+// *cur, the rate the job is known to run with. The global bwlimit is taken from the
+// supervisor's last settings refresh, so changes to it reach running jobs too.
+func (w *ruleWorker) applyBwlimit(ctx context.Context, settings store.RuntimeSettings, port int, jobID string, cur *string) {
+	if rate, ok := w.bwlimit.Get(); ok {
+		settings.Bwlimit = rate
+	}
+	rate := w.jobBwlimit(settings, time.Now())
+	if rate == *cur {
+		return
+	}
+	if err := setRCBwlimit(ctx, port, rate); err != nil {
+		log.Printf("rule %s: job %s: set bwlimit %s: %v", w.rule.ID, jobID, rate, err)
+		return
+	}
+	log.Printf("rule %s: job %s bwlimit %s -> %s", w.rule.ID, jobID, *cur, rate)
+	*cur = rate
+}
@@ -26,7 +26,9 @@ type ruleWorker struct {
 
 	pm *PortManager
 	gl *GlobalLimiter
-	jr *JobRegistry
+	// bwlimit is the global bwlimit as the supervisor last loaded it.
+	bwlimit *globalBwlimit
+	jr      *JobRegistry
 
 	sem chan struct{}
 
@@ -34,21 +36,59 @@ type ruleWorker struct {
 	stopCh chan struct{}
 	stopped atomic.Bool
 
+	// lastScanAt is the unix start time of the last successful full scan (sync rules use it
+	// to tell which done files disappeared from the source); lastListAt that of the last
+	// successful scan, full or incremental.
+	lastScanAt atomic.Int64
+	lastListAt atomic.Int64
+	// watching is set while watchLocal applies local changes, which makes scans between full
+	// scans unnecessary.
+	watching atomic.Bool
+	// syncBlocked holds the key (string) of the block last recorded as a failed job, so the
+	// scheduler records a blocked sync once instead of on every tick; "" when not blocked.
+	syncBlocked atomic.Value
+	// syncDeleting is held by the job that currently propagates deletions.
+	syncDeleting atomic.Bool
+
+	// bisyncMu is held by the scan that plans a bisync run and by the job executing it;
+	// bisyncPlan is guarded by it.
+	bisyncMu   sync.Mutex
+	bisyncPlan *bisyncPlan
+
+	// jobWindow and scanWindow are the parsed rule schedules (nil = always open).
+	jobWindow  *store.Schedule
+	scanWindow *store.Schedule
+	// forceScan lets a scan requested from the UI run outside the scan window.
+	forceScan atomic.Bool
+	// reconcileDest asks the next scan to reconcile the rule with its destination.
+	reconcileDest atomic.Bool
+	// fullScan asks the next scan to list the whole source, e.g. after the local watcher lost events.
+	fullScan atomic.Bool
+
 	cancelMu sync.Mutex
 	cancel   context.CancelFunc
 }
 
-func newRuleWorker(st *store.Store, rule store.Rule, pm *PortManager, gl *GlobalLimiter, jr *JobRegistry) *ruleWorker {
-	return &ruleWorker{
-		st:     st,
-		rule:   rule,
-		pm:     pm,
-		gl:     gl,
-		jr:     jr,
-		scanCh: make(chan struct{}, 1),
-		stopCh: make(chan struct{}),
-		sem:    make(chan struct{}, rule.MaxParallelJobs),
+func newRuleWorker(st *store.Store, rule store.Rule, pm *PortManager, gl *GlobalLimiter, bw *globalBwlimit, jr *JobRegistry) *ruleWorker {
+	w := &ruleWorker{
+		st:      st,
+		rule:    rule,
+		pm:      pm,
+		gl:      gl,
+		bwlimit: bw,
+		jr:      jr,
+		scanCh:  make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+		sem:     make(chan struct{}, rule.MaxParallelJobs),
+	}
+	var err error
+	if w.jobWindow, err = store.ParseSchedule(rule.JobSchedule); err != nil {
+		log.Printf("rule %s: job schedule: %v", rule.ID, err)
 	}
+	if w.scanWindow, err = store.ParseSchedule(rule.ScanSchedule); err != nil {
+		log.Printf("rule %s: scan schedule: %v", rule.ID, err)
+	}
+	return w
 }
 
 func (w *ruleWorker) setCancel(cancel context.CancelFunc) {
@@ -96,7 +136,7 @@ func (w *ruleWorker) run(ctx context.Context) {
 	schedTicker := time.NewTicker(settings.SchedulerTick)
 	defer schedTicker.Stop()
 
-	if w.rule.SrcKind == "local" && w.rule.LocalWatch {
+	if w.rule.SrcKind == "local" && w.rule.LocalWatch && w.rule.ParentID == "" {
 		go w.watchLocal(scanCtx)
 	}
 
@@ -121,30 +161,89 @@ func (w *ruleWorker) run(ctx context.Context) {
 }
 
 func (w *ruleWorker) doScan(ctx context.Context) {
+	if w.rule.ParentID != "" {
+		// Replicas of a fan-out rule are fed by the parent's scan.
+		return
+	}
+	forced := w.forceScan.Swap(false)
+	if !forced && !w.scanWindow.Active(time.Now()) {
+		return
+	}
 	settings, err := w.st.RuntimeSettings(ctx)
 	if err != nil {
 		log.Printf("rule %s: settings: %v", w.rule.ID, err)
 		return
 	}
-	entries, err := scanRule(ctx, w.rule, settings)
+	if w.rule.TransferMode == "bisync" {
+		w.scanBisync(ctx, settings)
+		return
+	}
+	filter, err := w.st.RuleFileFilter(ctx, w.rule)
 	if err != nil {
-		log.Printf("rule %s: scan: %v", w.rule.ID, err)
+		log.Printf("rule %s: filters: %v", w.rule.ID, err)
 		return
 	}
-	if err := w.st.UpsertScanEntries(ctx, w.rule, entries); err != nil {
-		log.Printf("rule %s: upsert scan: %v", w.rule.ID, err)
+	if w.rule.TransferMode == "sync" {
+		// Sync needs every listed path, filtered or not, to tell deletions apart; the scan writer filters.
+		filter = nil
+	}
+	replicas, err := w.st.ListReplicas(ctx, w.rule.ID)
+	if err != nil {
+		log.Printf("rule %s: list replicas: %v", w.rule.ID, err)
 		return
 	}
-	if _, err := w.st.EnqueueStable(ctx, w.rule.ID, w.rule.BatchSize, w.rule.MinFileSizeBytes); err != nil {
+	scanStart := time.Now()
+	wantFull := w.fullScan.Swap(false)
+	full := w.fullScanDue(scanStart, forced || wantFull || w.reconcileDest.Load())
+	if !full && w.watching.Load() {
+		// The watcher applies changes as they happen; only the periodic full scan lists the source.
+		if _, err := w.st.EnqueueStable(ctx, w.rule); err != nil {
+			log.Printf("rule %s: enqueue stable: %v", w.rule.ID, err)
+		}
+		w.cleanupSource(ctx, settings)
+		return
+	}
+	// The listing is written into the rule and its replicas in chunks as rclone produces it.
+	sw, err := w.st.NewScanWriter(ctx, append([]store.Rule{w.rule}, replicas...), full)
+	if err != nil {
+		log.Printf("rule %s: start scan: %v", w.rule.ID, err)
+		return
+	}
+	err = w.listSource(ctx, filter, settings, full, sw.Add)
+	if cerr := sw.Close(err); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Printf("rule %s: scan: %v", w.rule.ID, err)
+		if wantFull {
+			w.fullScan.Store(true)
+		}
+		return
+	}
+	// Only a full listing tells which files disappeared and what the destination should hold.
+	if full {
+		reconcile := w.reconcileDest.Swap(false)
+		for _, r := range append([]store.Rule{w.rule}, replicas...) {
+			w.handleMissing(ctx, r, scanStart)
+			w.maybeReconcileDest(ctx, settings, r, reconcile)
+		}
+		w.lastScanAt.Store(scanStart.Unix())
+	}
+	w.lastListAt.Store(scanStart.Unix())
+	if _, err := w.st.EnqueueStable(ctx, w.rule); err != nil {
 		log.Printf("rule %s: enqueue stable: %v", w.rule.ID, err)
 	}
+	w.cleanupSource(ctx, settings)
 }
 
 func (w *ruleWorker) doSchedule(scanCtx context.Context, jobCtx context.Context) {
 	// keep queue warm
-	if _, err := w.st.EnqueueStable(scanCtx, w.rule.ID, w.rule.BatchSize, w.rule.MinFileSizeBytes); err != nil {
+	if _, err := w.st.EnqueueStable(scanCtx, w.rule); err != nil {
 		log.Printf("rule %s: enqueue stable: %v", w.rule.ID, err)
 	}
+	if !w.jobWindow.Active(time.Now()) {
+		return
+	}
 	for {
 		select {
 		case <-scanCtx.Done():
@@ -170,14 +269,83 @@ func (w *ruleWorker) startOneJob(scanCtx context.Context, jobCtx context.Context
 		log.Printf("rule %s: settings: %v", w.rule.ID, err)
 		return
 	}
-	if !w.st.HasQueued(scanCtx, w.rule.ID) {
+	// Sync rules also propagate source deletions; they need a completed scan to know what disappeared.
+	var deletions []string
+	if w.rule.TransferMode == "sync" {
+		scanAt := w.lastScanAt.Load()
+		if scanAt == 0 {
+			return
+		}
+		deletions, err = w.st.SyncDeletionCandidates(scanCtx, w.rule.ID, time.Unix(scanAt, 0))
+		if err != nil {
+			log.Printf("rule %s: sync deletions: %v", w.rule.ID, err)
+			return
+		}
+		if w.rule.MissingAction == "propagate" {
+			missing, err := w.st.MissingDeletionCandidates(scanCtx, w.rule)
+			if err != nil {
+				log.Printf("rule %s: missing deletions: %v", w.rule.ID, err)
+				return
+			}
+			deletions = append(deletions, missing...)
+		}
+		if len(deletions) > 0 {
+			seen, err := w.st.CountSeenSince(scanCtx, w.rule.ID, time.Unix(scanAt, 0))
+			if err != nil {
+				log.Printf("rule %s: count listed files: %v", w.rule.ID, err)
+				return
+			}
+			// An unmounted disk or a wrong path lists as empty; don't delete the whole destination.
+			if seen == 0 {
+				w.recordBlockedSync(jobCtx, fmt.Sprintf("empty/%d", len(deletions)),
+					fmt.Sprintf("sync blocked: the source listed no files, %d transferred files would be deleted", len(deletions)))
+				return
+			}
+			tracked, err := w.st.CountRuleFiles(scanCtx, w.rule.ID)
+			if err != nil {
+				log.Printf("rule %s: count files: %v", w.rule.ID, err)
+				return
+			}
+			if limit := w.rule.MaxDeleteLimit(tracked); limit >= 0 && len(deletions) > limit {
+				w.recordBlockedSync(jobCtx, fmt.Sprintf("%d/%d", len(deletions), limit), maxDeleteReason(w.rule, len(deletions), limit, tracked))
+				return
+			}
+		}
+		w.syncBlocked.Store("")
+	}
+	if len(deletions) > 0 {
+		if w.syncDeleting.CompareAndSwap(false, true) {
+			defer w.syncDeleting.Store(false)
+		} else {
+			deletions = nil
+		}
+	}
+	var plan *bisyncPlan
+	if w.rule.TransferMode == "bisync" {
+		// One bisync run at a time: it works from listings of both whole sides.
+		if !w.bisyncMu.TryLock() {
+			return
+		}
+		defer w.bisyncMu.Unlock()
+		plan = w.bisyncPlan
+		if plan == nil {
+			return
+		}
+		if limit := w.rule.MaxDeleteLimit(plan.Tracked); limit >= 0 && plan.deletions() > limit {
+			w.bisyncPlan = nil
+			w.recordBlockedSync(jobCtx, fmt.Sprintf("%d/%d", plan.deletions(), limit), maxDeleteReason(w.rule, plan.deletions(), limit, plan.Tracked))
+			return
+		}
+		w.syncBlocked.Store("")
+	} else if len(deletions) == 0 && !w.st.HasQueued(scanCtx, w.rule.ID) {
 		return
 	}
 
-	limitBytes := w.rule.DailyLimitBytes
-	budgetFn := func() (int64, error) {
-		return w.st.RuleBudgetSince(scanCtx, w.rule.ID, time.Now().Add(-24*time.Hour))
-	}
+	now := time.Now()
+	dstRemote := "" // "" = rule's dst_remote; set when spilling over to a group fallback
+	// account is the group's service account the job runs as (accountFile is its path).
+	var account, accountFile string
+	quotas := w.ruleQuotas(scanCtx, now)
 	// If grouped, use group logic
 	if w.rule.LimitGroup != "" {
 		lg, ok, err := w.st.GetLimitGroup(scanCtx, w.rule.LimitGroup)
@@ -185,28 +353,54 @@ func (w *ruleWorker) startOneJob(scanCtx context.Context, jobCtx context.Context
 			log.Printf("rule %s: get limit group: %v", w.rule.ID, err)
 			return
 		}
+		// Group not found (deleted while the rule still references it): no limit.
+		quotas = nil
 		if ok {
-			limitBytes = lg.DailyLimitBytes
-		} else {
-			// Group not found? fallback to rule's limit or 0?
-			// Let's assume 0 (unlimited) or log warning.
-			// Ideally the UI prevents selecting non-existent groups, but user can delete group.
-			limitBytes = 0
-		}
-
-		budgetFn = func() (int64, error) {
-			return w.st.GroupBudgetSince(scanCtx, w.rule.LimitGroup, time.Now().Add(-24*time.Hour))
+			quotas = w.groupQuotas(scanCtx, lg, now)
+			canSpill := len(lg.Fallbacks) > 0 && (w.rule.TransferMode == "copy" || w.rule.TransferMode == "move")
+			exhausted := w.quotaPaused(scanCtx, store.GroupQuotaScope(lg.Name, ""), now)
+			if !exhausted && len(quotas) > 0 && canSpill {
+				_, _, ok, err := remainingQuota(quotas)
+				if err != nil {
+					log.Printf("rule %s: check budget usage: %v", w.rule.ID, err)
+					return
+				}
+				exhausted = !ok
+			}
+			if !exhausted && lg.ServiceAccountDir != "" {
+				sa, saQuotas, ok := w.pickServiceAccount(scanCtx, lg, now)
+				if ok {
+					account, accountFile = sa, filepath.Join(lg.ServiceAccountDir, sa)
+					quotas = append(quotas, saQuotas...)
+				} else {
+					// Every account is used up: the group's own destinations are too.
+					exhausted = true
+				}
+			}
+			if exhausted {
+				if !canSpill {
+					return
+				}
+				fb, ok := w.pickFallback(scanCtx, lg, now)
+				if !ok {
+					return
+				}
+				dstRemote = fb.DstRemote
+				account, accountFile = "", ""
+				quotas = w.fallbackQuotas(scanCtx, lg, fb, now)
+			}
 		}
+	} else if w.quotaPaused(scanCtx, store.RuleQuotaScope(w.rule.ID), now) {
+		return
 	}
 
-	if limitBytes > 0 {
-		usage, err := budgetFn()
-		if err != nil {
-			log.Printf("rule %s: check budget usage: %v", w.rule.ID, err)
-		} else if usage >= limitBytes {
-			// Limit reached.
-			return
-		}
+	// remaining is what is left of the tightest quota; the claim only takes files that fit into it.
+	remaining, filesLeft, ok, err := remainingQuota(quotas)
+	if err != nil {
+		log.Printf("rule %s: check budget usage: %v", w.rule.ID, err)
+	} else if !ok {
+		// Limit reached.
+		return
 	}
 
 	if w.gl != nil {
@@ -222,35 +416,55 @@ func (w *ruleWorker) startOneJob(scanCtx context.Context, jobCtx context.Context
 	}
 	defer w.pm.Release(port)
 
+	if plan != nil {
+		w.runBisyncJob(scanCtx, jobCtx, settings, port, plan)
+		return
+	}
+
 	jobID := newID()
-	paths, err := w.st.ClaimQueuedForJob(scanCtx, w.rule, jobID, w.rule.BatchSize)
+	claimLimit := 0 // rule.BatchSize
+	if filesLeft > 0 && filesLeft < int64(w.rule.BatchSize) {
+		claimLimit = int(filesLeft)
+	}
+	batches, err := w.st.ClaimQueuedForJob(scanCtx, w.rule, jobID, store.ClaimOptions{
+		Limit:      claimLimit,
+		DstRemote:  dstRemote,
+		MaxBytes:   remaining,
+		BatchBytes: w.rule.BatchMaxBytes,
+	})
 	if err != nil {
 		log.Printf("rule %s: claim queued: %v", w.rule.ID, err)
 		return
 	}
-	if len(paths) == 0 {
+	var paths []string
+	for _, b := range batches {
+		paths = append(paths, b.Paths...)
+	}
+	if len(paths) == 0 && len(deletions) == 0 {
 		return
 	}
 
 	// Pre-check limit with estimated size.
 	// Budget usage includes in-flight transferring file sizes, which prevents concurrent jobs
 	// in the same group from collectively exceeding quota.
-	if limitBytes > 0 {
+	if len(quotas) > 0 {
 		jobSize, err := w.st.GetJobFilesSize(jobCtx, jobID)
 		if err == nil {
-			currentBudget, _ := budgetFn()
-			if currentBudget > limitBytes {
-				log.Printf("rule %s: daily limit exceeded (budget: %d, job: %d, limit: %d), skipping job %s",
-					w.rule.ID, currentBudget, jobSize, limitBytes, jobID)
-				_ = w.st.ReleaseTransferringBackToQueued(jobCtx, jobID)
-				return
+			for _, q := range quotas {
+				currentBudget, _ := q.budget()
+				if currentBudget > q.limit {
+					log.Printf("rule %s: %s limit exceeded (budget: %d, job: %d, limit: %d), skipping job %s",
+						w.rule.ID, q.name, currentBudget, jobSize, q.limit, jobID)
+					_ = w.st.ReleaseTransferringBackToQueued(jobCtx, jobID)
+					return
+				}
 			}
 		} else {
 			log.Printf("rule %s: check job size: %v", w.rule.ID, err)
 		}
 	}
 
-	log.Printf("[Worker] Job %s (Rule: %s) starting with %d files", jobID, w.rule.ID, len(paths))
+	log.Printf("[Worker] Job %s (Rule: %s) starting with %d files, %d deletions", jobID, w.rule.ID, len(paths), len(deletions))
 	if w.stopped.Load() || scanCtx.Err() != nil {
 		_ = w.st.ReleaseTransferringBackToQueued(jobCtx, jobID)
 		return
@@ -264,11 +478,26 @@ func (w *ruleWorker) startOneJob(scanCtx context.Context, jobCtx context.Context
 		return
 	}
 
-	filesFrom := filepath.Join(jobDir, "files.txt")
-	if err := os.WriteFile(filesFrom, []byte(strings.Join(paths, "\n")+"\n"), 0o600); err != nil {
-		log.Printf("rule %s: write files-from: %v", w.rule.ID, err)
-		_ = w.st.ReleaseTransferringBackToQueued(jobCtx, jobID)
-		return
+	// For sync, deleted source paths are listed too: rclone then removes them from the destination.
+	// Sync rules have no dst_path placeholders, so there is at most one batch.
+	if len(deletions) > 0 {
+		if len(batches) == 0 {
+			batches = []store.ClaimedBatch{{DstPath: w.rule.DstPath}}
+		}
+		batches[0].Paths = append(batches[0].Paths, deletions...)
+	}
+	filesFroms := make([]string, len(batches))
+	for i, b := range batches {
+		name := "files.txt"
+		if len(batches) > 1 {
+			name = fmt.Sprintf("files-%d.txt", i+1)
+		}
+		filesFroms[i] = filepath.Join(jobDir, name)
+		if err := os.WriteFile(filesFroms[i], []byte(strings.Join(b.Paths, "\n")+"\n"), 0o600); err != nil {
+			log.Printf("rule %s: write files-from: %v", w.rule.ID, err)
+			_ = w.st.ReleaseTransferringBackToQueued(jobCtx, jobID)
+			return
+		}
 	}
 
 	if w.stopped.Load() || scanCtx.Err() != nil {
@@ -278,12 +507,17 @@ func (w *ruleWorker) startOneJob(scanCtx context.Context, jobCtx context.Context
 
 	logPath := filepath.Join(settings.LogDir, w.rule.ID, jobID+".log")
 	j := store.Job{
-		JobID:        jobID,
-		RuleID:       w.rule.ID,
-		TransferMode: w.rule.TransferMode,
-		RcPort:       port,
-		StartedAt:    time.Now(),
-		LogPath:      logPath,
+		JobID:          jobID,
+		RuleID:         w.rule.ID,
+		TransferMode:   w.rule.TransferMode,
+		DstRemote:      dstRemote,
+		RcPort:         port,
+		StartedAt:      time.Now(),
+		LogPath:        logPath,
+		ServiceAccount: account,
+	}
+	if dstRemote != "" {
+		log.Printf("rule %s: group %s quota reached, job %s spills over to %s", w.rule.ID, w.rule.LimitGroup, jobID, dstRemote)
 	}
 	if err := w.st.CreateJobRow(jobCtx, j); err != nil {
 		log.Printf("rule %s: create job: %v", w.rule.ID, err)
@@ -300,46 +534,45 @@ func (w *ruleWorker) startOneJob(scanCtx context.Context, jobCtx context.Context
 	jobCtx, cancel := context.WithCancel(jobCtx)
 	defer cancel()
 
-	res := w.runWithMetrics(jobCtx, settings, port, filesFrom, logPath, jobID)
+	res := w.runBatches(jobCtx, settings, port, dstRemote, accountFile, batches, filesFroms, logPath, jobID)
+	// Every outcome verifies the files it marks done, including jobs that stopped part way.
+	verify := func() { w.verifyJob(jobCtx, settings, dstRemote, accountFile, batches, jobDir, jobID) }
 	if res.Err != nil {
 		if errors.Is(res.Err, errTerminatedByUser) {
 			_ = w.st.UpdateJobTerminated(jobCtx, jobID, "terminated by user", res.BytesDone, res.AvgSpeed)
-			doneSet, _ := transferredPathsFromLog(logPath)
-			var donePaths []string
-			for _, p := range paths {
-				if _, ok := doneSet[p]; ok {
-					donePaths = append(donePaths, p)
-				}
-			}
-			_ = w.st.FinalizeJobFiles(jobCtx, jobID, donePaths, "queued", "")
-			_ = w.st.ClearJobOnDone(jobCtx, jobID)
+			w.requeueUnfinished(jobCtx, jobID, logPath, paths, verify)
 			return
 		}
-		if errors.Is(res.Err, errTerminatedBySignal) || errors.Is(res.Err, context.Canceled) {
-			_ = w.st.UpdateJobTerminated(jobCtx, jobID, "terminated", res.BytesDone, res.AvgSpeed)
-			doneSet, _ := transferredPathsFromLog(logPath)
-			var donePaths []string
-			for _, p := range paths {
-				if _, ok := doneSet[p]; ok {
-					donePaths = append(donePaths, p)
-				}
+		if errors.Is(res.Err, errTerminatedBySignal) || errors.Is(res.Err, context.Canceled) || errors.Is(res.Err, errOutsideWindow) {
+			reason := "terminated"
+			if errors.Is(res.Err, errOutsideWindow) {
+				reason = errOutsideWindow.Error()
 			}
-			_ = w.st.FinalizeJobFiles(jobCtx, jobID, donePaths, "queued", "")
-			_ = w.st.ClearJobOnDone(jobCtx, jobID)
+			_ = w.st.UpdateJobTerminated(jobCtx, jobID, reason, res.BytesDone, res.AvgSpeed)
+			w.requeueUnfinished(jobCtx, jobID, logPath, paths, verify)
 			return
 		}
-		_ = w.st.UpdateJobFailed(jobCtx, jobID, res.Err.Error(), res.BytesDone, res.AvgSpeed)
-		doneSet, _ := transferredPathsFromLog(logPath)
-		var donePaths []string
-		for _, p := range paths {
-			if _, ok := doneSet[p]; ok {
-				donePaths = append(donePaths, p)
-			}
+		if reason, ok := quotaErrorFrom(logPath, res.Err); ok {
+			// The provider's quota is used up: pause instead of failing the files, which go
+			// back to the queue without counting against fail_count.
+			_ = w.st.UpdateJobFailed(jobCtx, jobID, "provider quota exceeded: "+reason, res.BytesDone, res.AvgSpeed)
+			w.requeueUnfinished(jobCtx, jobID, logPath, paths, verify)
+			w.pauseForQuota(jobCtx, settings, dstRemote, account, reason)
+			return
 		}
-		_ = w.st.FinalizeJobFiles(jobCtx, jobID, donePaths, "failed", res.Err.Error())
-		_ = w.st.ClearJobOnDone(jobCtx, jobID)
+		donePaths := logDonePaths(logPath, paths)
+		_ = w.st.UpdateJobFailed(jobCtx, jobID, res.Err.Error(), res.BytesDone, res.AvgSpeed)
+		fileErrs, _ := fileErrorsFromLog(logPath, paths)
+		_ = w.st.FailJobFiles(jobCtx, jobID, donePaths, res.Err.Error(), fileErrs)
+		verify()
+		w.releaseDone(jobCtx, jobID)
 		return
 	}
+	if len(deletions) > 0 {
+		if err := w.st.DeleteRuleFiles(jobCtx, w.rule.ID, deletions); err != nil {
+			log.Printf("rule %s: drop synced deletions: %v", w.rule.ID, err)
+		}
+	}
 	doneSet, err := transferredPathsFromLog(logPath)
 	if err != nil {
 		_ = w.st.UpdateJobFailed(jobCtx, jobID, "log parse: "+err.Error(), res.BytesDone, res.AvgSpeed)
@@ -357,18 +590,78 @@ func (w *ruleWorker) startOneJob(scanCtx context.Context, jobCtx context.Context
 		// In that case we should treat all claimed paths as finished to avoid endless re-queue loops.
 		if len(donePaths) == 0 && logHadNothingToTransfer(logPath) {
 			_ = w.st.UpdateJobDone(jobCtx, jobID, res.BytesDone, res.AvgSpeed)
-			_ = w.st.FinalizeJobFiles(jobCtx, jobID, paths, "queued", "")
-			_ = w.st.ClearJobOnDone(jobCtx, jobID)
+			_ = w.st.FinalizeSkippedJobFiles(jobCtx, jobID, paths)
+			verify()
+			w.releaseDone(jobCtx, jobID)
 			return
 		}
 		_ = w.st.UpdateJobFailed(jobCtx, jobID, fmt.Sprintf("incomplete: %d/%d transferred", len(donePaths), len(paths)), res.BytesDone, res.AvgSpeed)
 		_ = w.st.FinalizeJobFiles(jobCtx, jobID, donePaths, "queued", "")
-		_ = w.st.ClearJobOnDone(jobCtx, jobID)
+		verify()
+		w.releaseDone(jobCtx, jobID)
 		return
 	}
 	_ = w.st.UpdateJobDone(jobCtx, jobID, res.BytesDone, res.AvgSpeed)
 	_ = w.st.FinalizeJobFiles(jobCtx, jobID, donePaths, "queued", "")
-	_ = w.st.ClearJobOnDone(jobCtx, jobID)
+	verify()
+	w.releaseDone(jobCtx, jobID)
+}
+
+// logDonePaths returns the paths the job log reports as transferred.
+func logDonePaths(logPath string, paths []string) []string {
+	doneSet, _ := transferredPathsFromLog(logPath)
+	var donePaths []string
+	for _, p := range paths {
+		if _, ok := doneSet[p]; ok {
+			donePaths = append(donePaths, p)
+		}
+	}
+	return donePaths
+}
+
+// requeueUnfinished finishes a job that stopped early: the files its log reports as transferred
+// are done and verified, the rest go back to the queue without counting as failed.
+func (w *ruleWorker) requeueUnfinished(ctx context.Context, jobID, logPath string, paths []string, verify func()) {
+	_ = w.st.FinalizeJobFiles(ctx, jobID, logDonePaths(logPath, paths), "queued", "")
+	verify()
+	w.releaseDone(ctx, jobID)
+}
+
+// releaseDone hands the job's completed files to downstream rules and detaches them from the job.
+func (w *ruleWorker) releaseDone(ctx context.Context, jobID string) {
+	if n, err := w.st.FeedDownstream(ctx, w.rule, jobID); err != nil {
+		log.Printf("rule %s: feed downstream: %v", w.rule.ID, err)
+	} else if n > 0 {
+		log.Printf("rule %s: job %s fed %d file(s) downstream", w.rule.ID, jobID, n)
+	}
+	_ = w.st.ClearJobOnDone(ctx, jobID)
+}
+
+func maxDeleteReason(rule store.Rule, deletions, limit, tracked int) string {
+	return fmt.Sprintf("%s blocked: %d deletions exceed max_delete %s (limit %d of %d tracked files)",
+		rule.TransferMode, deletions, rule.MaxDelete, limit, tracked)
+}
+
+// recordBlockedSync stores a failed job explaining why a sync/bisync run was not started. The
+// same block (by key) is recorded once, until the run goes ahead or the block changes.
+func (w *ruleWorker) recordBlockedSync(ctx context.Context, key, reason string) {
+	if last, _ := w.syncBlocked.Load().(string); last == key {
+		return
+	}
+	w.syncBlocked.Store(key)
+	jobID := newID()
+	log.Printf("rule %s: %s", w.rule.ID, reason)
+	j := store.Job{
+		JobID:        jobID,
+		RuleID:       w.rule.ID,
+		TransferMode: w.rule.TransferMode,
+		StartedAt:    time.Now(),
+	}
+	if err := w.st.CreateJobRow(ctx, j); err != nil {
+		log.Printf("rule %s: create job: %v", w.rule.ID, err)
+		return
+	}
+	_ = w.st.UpdateJobFailed(ctx, jobID, reason, 0, 0)
 }
 
 func (w *ruleWorker) watchLocal(ctx context.Context) {
@@ -398,6 +691,8 @@ func (w *ruleWorker) watchLocal(ctx context.Context) {
 		}
 		return nil
 	})
+	w.watching.Store(true)
+	defer w.watching.Store(false)
 
 	debounce := time.NewTimer(0)
 	if !debounce.Stop() {
@@ -412,12 +707,45 @@ func (w *ruleWorker) watchLocal(ctx context.Context) {
 		debounce.Reset(600 * time.Millisecond)
 	}
 
+	// Changed paths are applied to the files table directly; settling files are looked at
+	// again once they are old enough to become stable.
+	changed := map[string]struct{}{}
+	settling := map[string]time.Time{}
+	flush := func() {
+		now := time.Now()
+		if !w.scanWindow.Active(now) {
+			return
+		}
+		for p, at := range settling {
+			if !at.After(now) {
+				changed[p] = struct{}{}
+				delete(settling, p)
+			}
+		}
+		if len(changed) == 0 {
+			return
+		}
+		if err := w.applyLocalChanges(ctx, root, changed, settling); err != nil {
+			log.Printf("rule %s: apply local changes: %v", w.rule.ID, err)
+			w.fullScan.Store(true)
+			w.triggerScan()
+		}
+		changed = map[string]struct{}{}
+	}
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case err := <-watcher.Errors:
-			if err != nil {
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Events were dropped; only listing everything again tells what they were.
+				log.Printf("rule %s: local watch overflow, running a full scan", w.rule.ID)
+				w.fullScan.Store(true)
+				w.triggerScan()
+			} else if err != nil {
 				log.Printf("rule %s: local watch error: %v", w.rule.ID, err)
 			}
 		case ev := <-watcher.Events:
@@ -433,10 +761,15 @@ func (w *ruleWorker) watchLocal(ctx context.Context) {
 					})
 				}
 			}
+			changed[ev.Name] = struct{}{}
 			trigger()
 		case <-debounce.C:
 			pending = false
-			w.triggerScan()
+			flush()
+		case <-tick.C:
+			if !pending {
+				flush()
+			}
 		}
 	}
 }
@@ -449,19 +782,12 @@ type jobResult struct {
 
 var errTerminatedByUser = errors.New("terminated by user")
 var errTerminatedBySignal = errors.New("terminated by signal")
+var errOutsideWindow = errors.New("outside job window")
 
-func (w *ruleWorker) runWithMetrics(ctx context.Context, settings store.RuntimeSettings, port int, filesFromPath, logPath, jobID string) jobResult {
-	var src string
-	if w.rule.SrcKind == "local" {
-		src = w.rule.SrcLocalRoot
-	} else {
-		src = fmt.Sprintf("%s:%s", w.rule.SrcRemote, w.rule.SrcPath)
-	}
-	dst := fmt.Sprintf("%s:%s", w.rule.DstRemote, w.rule.DstPath)
-
+// rcArgs returns the flags every job-controlled rclone process needs:
+// stats/rc endpoint for metrics, log file and global transfer settings.
+func rcArgs(settings store.RuntimeSettings, port int, logPath string) []string {
 	args := []string{
-		w.rule.TransferMode,
-		src, dst,
 		"--stats", "0",
 		"--rc",
 		"--rc-no-auth",
@@ -474,23 +800,118 @@ func (w *ruleWorker) runWithMetrics(ctx context.Context, settings store.RuntimeS
 	if strings.TrimSpace(settings.RcloneConfigPath) != "" {
 		args = append(args, "--config", settings.RcloneConfigPath)
 	}
-	if strings.TrimSpace(filesFromPath) != "" {
-		// Newer rclone versions forbid combining --files-from with any other filter options (e.g. --exclude).
-		// Use --files-from-raw so extension filters and user extra args keep working together.
-		args = append(args, "--files-from-raw", filesFromPath)
-	}
+	return args
+}
+
+// tuningArgs returns buffer/chunk/bandwidth flags for transfers of this rule.
+func (w *ruleWorker) tuningArgs(settings store.RuntimeSettings) []string {
+	var args []string
 	if settings.BufferSize != "" {
 		args = append(args, "--buffer-size", settings.BufferSize)
 	}
 	if settings.DriveChunkSize != "" {
 		args = append(args, "--drive-chunk-size", settings.DriveChunkSize)
 	}
-	effectiveBwlimit := strings.TrimSpace(w.rule.Bwlimit)
-	if effectiveBwlimit == "" {
-		effectiveBwlimit = strings.TrimSpace(settings.Bwlimit)
+	if rate := store.EffectiveBwlimit(w.rule.Bwlimit, settings.Bwlimit, time.Now()); rate != "" {
+		args = append(args, "--bwlimit", rate)
+	}
+	return args
+}
+
+func ruleSource(rule store.Rule) string {
+	if rule.SrcKind == "local" {
+		return rule.SrcLocalRoot
+	}
+	return fmt.Sprintf("%s:%s", rule.SrcRemote, rule.SrcPath)
+}
+
+func ruleDest(rule store.Rule) string {
+	return fmt.Sprintf("%s:%s", rule.DstRemote, rule.DstPath)
+}
+
+// extraArgs returns the rule's sanitized rclone_extra_args. Filter flags are dropped when the
+// command also gets --files-from-raw, which rclone refuses to combine with other filters.
+func (w *ruleWorker) extraArgs(withFilesFrom bool) ([]string, error) {
+	if strings.TrimSpace(w.rule.RcloneExtraArgs) == "" {
+		return nil, nil
+	}
+	parsed, err := ParseRcloneArgs(w.rule.RcloneExtraArgs)
+	if err != nil {
+		return nil, err
+	}
+	san := SanitizeRcloneArgs(parsed)
+	if withFilesFrom {
+		san = SanitizeRcloneFilterArgs(san.Args)
+	}
+	return san.Args, nil
+}
+
+// pickFallback returns the first fallback destination of lg with quota left in the group's day window.
+func (w *ruleWorker) pickFallback(ctx context.Context, lg store.LimitGroup, now time.Time) (store.LimitGroupFallback, bool) {
+	for _, fb := range lg.Fallbacks {
+		if fb.DstRemote == w.rule.DstRemote || w.quotaPaused(ctx, store.GroupQuotaScope(lg.Name, fb.DstRemote), now) {
+			continue
+		}
+		_, _, ok, err := remainingQuota(w.fallbackQuotas(ctx, lg, fb, now))
+		if err != nil {
+			log.Printf("rule %s: check fallback %s usage: %v", w.rule.ID, fb.DstRemote, err)
+			continue
+		}
+		if ok {
+			return fb, true
+		}
+	}
+	return store.LimitGroupFallback{}, false
+}
+
+// runBatches runs one rclone invocation per destination batch, stopping at the first error.
+func (w *ruleWorker) runBatches(ctx context.Context, settings store.RuntimeSettings, port int, dstRemote, accountFile string, batches []store.ClaimedBatch, filesFroms []string, logPath, jobID string) jobResult {
+	start := time.Now()
+	var res jobResult
+	for i, b := range batches {
+		r := w.runWithMetrics(ctx, settings, port, dstRemote, accountFile, b.DstPath, filesFroms[i], logPath, jobID)
+		res.BytesDone += r.BytesDone
+		if r.Err != nil {
+			res.Err = r.Err
+			break
+		}
+	}
+	res.AvgSpeed = avgSpeed(res.BytesDone, start)
+	return res
+}
+
+// runWithMetrics runs the rule's transfer into dstRemote:dstPath ("" means the rule's dst_remote
+// and dst_path respectively), as the Google Drive service account in accountFile if set.
+func (w *ruleWorker) runWithMetrics(ctx context.Context, settings store.RuntimeSettings, port int, dstRemote, accountFile, dstPath, filesFromPath, logPath, jobID string) jobResult {
+	src := ruleSource(w.rule)
+	dstRule := w.rule
+	if dstRemote != "" {
+		dstRule.DstRemote = dstRemote
 	}
-	if effectiveBwlimit != "" {
-		args = append(args, "--bwlimit", effectiveBwlimit)
+	if dstPath != "" {
+		dstRule.DstPath = dstPath
+	}
+	dst := ruleDest(dstRule)
+
+	args := []string{w.rule.TransferMode, src, dst}
+	args = append(args, rcArgs(settings, port, logPath)...)
+	if strings.TrimSpace(filesFromPath) != "" {
+		// Newer rclone versions forbid combining --files-from with any other filter options (e.g. --exclude).
+		// Use --files-from-raw so extension filters and user extra args keep working together.
+		args = append(args, "--files-from-raw", filesFromPath)
+	}
+	if w.rule.TransferMode == "sync" {
+		// Hard backstop for the pre-flight check in startOneJob.
+		tracked, _ := w.st.CountRuleFiles(ctx, w.rule.ID)
+		if limit := w.rule.MaxDeleteLimit(tracked); limit >= 0 {
+			args = append(args, "--max-delete", fmt.Sprintf("%d", limit))
+		}
+	}
+	args = append(args, w.tuningArgs(settings)...)
+	if accountFile != "" {
+		// Stop at the account's daily upload limit instead of retrying into it, so the job fails
+		// with the quota error and the next job moves on to another account.
+		args = append(args, "--drive-service-account-file", accountFile, "--drive-stop-on-upload-limit")
 	}
 	if w.rule.MinFileSizeBytes > 0 {
 		// When using --files-from/--files-from-raw, rclone forbids combining with any other filter options.
@@ -510,18 +931,17 @@ func (w *ruleWorker) runWithMetrics(ctx context.Context, settings store.RuntimeS
 			}
 		}
 	}
-	if strings.TrimSpace(w.rule.RcloneExtraArgs) != "" {
-		parsed, err := ParseRcloneArgs(w.rule.RcloneExtraArgs)
-		if err != nil {
-			return jobResult{Err: err}
-		}
-		san := SanitizeRcloneArgs(parsed)
-		if strings.TrimSpace(filesFromPath) != "" {
-			san = SanitizeRcloneFilterArgs(san.Args)
-		}
-		args = append(args, san.Args...)
+	extra, err := w.extraArgs(strings.TrimSpace(filesFromPath) != "")
+	if err != nil {
+		return jobResult{Err: err}
 	}
+	args = append(args, extra...)
+	return w.runRclone(ctx, settings, port, args, logPath, jobID)
+}
 
+// runRclone starts rclone with args, samples its rc stats into job_metrics until it exits,
+// and registers the process so it can be terminated from the UI.
+func (w *ruleWorker) runRclone(ctx context.Context, settings store.RuntimeSettings, port int, args []string, logPath, jobID string) jobResult {
 	_ = os.MkdirAll(filepath.Dir(logPath), 0o755)
 	log.Printf("[Executor] Job %s: running rclone %s", jobID, strings.Join(args, " "))
 	cmd := exec.CommandContext(ctx, "rclone", args...)
@@ -538,6 +958,9 @@ func (w *ruleWorker) runWithMetrics(ctx context.Context, settings store.RuntimeS
 		defer w.jr.Unregister(jobID)
 	}
 
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
 	start := time.Now()
 	readyUntil := time.Now().Add(10 * time.Second)
 	var last rcStats
@@ -547,15 +970,24 @@ func (w *ruleWorker) runWithMetrics(ctx context.Context, settings store.RuntimeS
 			last = s
 			break
 		}
-		time.Sleep(200 * time.Millisecond)
+		select {
+		case err := <-done:
+			// Short-lived commands may exit before rc comes up; hand the result to the loop below.
+			done <- err
+			readyUntil = time.Time{}
+		case <-time.After(200 * time.Millisecond):
+		}
 	}
 
-	done := make(chan error, 1)
-	go func() { done <- cmd.Wait() }()
-
 	ticker := time.NewTicker(settings.MetricsInterval)
 	defer ticker.Stop()
 
+	// rate is what the process started with (see tuningArgs); timetables and throttled job
+	// windows change it over rc while the job runs.
+	rate := store.EffectiveBwlimit(w.rule.Bwlimit, settings.Bwlimit, start)
+	if rate == "" {
+		rate = "off"
+	}
 	for {
 		select {
 		case <-ctx.Done():
@@ -590,6 +1022,14 @@ func (w *ruleWorker) runWithMetrics(ctx context.Context, settings store.RuntimeS
 			log.Printf("[Executor] Job %s finished: %v (Done: %d bytes, AvgSpeed: %.2f B/s)", jobID, res.Err, res.BytesDone, res.AvgSpeed)
 			return res
 		case <-ticker.C:
+			if w.windowClosed(jobID) {
+				_ = cmd.Process.Kill()
+				_ = <-done
+				res := jobResult{BytesDone: last.Bytes, AvgSpeed: avgSpeed(last.Bytes, start), Err: errOutsideWindow}
+				log.Printf("[Executor] Job %s finished: %v (Done: %d bytes, AvgSpeed: %.2f B/s)", jobID, res.Err, res.BytesDone, res.AvgSpeed)
+				return res
+			}
+			w.applyBwlimit(ctx, settings, port, jobID, &rate)
 			s, err := pollRC(ctx, port)
 			if err != nil {
 				continue
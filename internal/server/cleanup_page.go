@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ruleCleanupGet lists the rule's latest source cleanups (see Rule.SourceDeleteAfterDays).
+func (s *Server) ruleCleanupGet(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := strings.TrimSpace(c.Query("id"))
+	rule, ok, err := s.st.GetRule(ctx, id)
+	if err != nil || !ok {
+		c.String(http.StatusNotFound, "规则不存在")
+		return
+	}
+	const limit = 500
+	deletions, err := s.st.ListSourceDeletions(ctx, rule.ID, limit)
+	s.render(c, "rule_cleanup", map[string]any{
+		"Active":    "rules",
+		"Rule":      rule,
+		"Deletions": deletions,
+		"Limit":     limit,
+		"Error":     errString(err),
+	})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ruleDeadGet lists the rule's dead files: those that failed as often as the retry policy allows.
+func (s *Server) ruleDeadGet(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := strings.TrimSpace(c.Query("id"))
+	rule, ok, err := s.st.GetRule(ctx, id)
+	if err != nil || !ok {
+		c.String(http.StatusNotFound, "规则不存在")
+		return
+	}
+	const limit = 500
+	files, err := s.st.ListDeadFiles(ctx, rule.ID, limit)
+	settings, _ := s.st.RuntimeSettings(ctx)
+	s.render(c, "rule_dead", map[string]any{
+		"Active":      "rules",
+		"Rule":        rule,
+		"Files":       files,
+		"Limit":       limit,
+		"MaxAttempts": settings.RetryMaxAttempts,
+		"Error":       errString(err),
+	})
+}
+
+// ruleDeadRequeuePost queues the posted dead files again; with "all" set every dead file of the rule.
+func (s *Server) ruleDeadRequeuePost(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := strings.TrimSpace(c.PostForm("id"))
+	paths := splitPaths(c.PostFormArray("paths"))
+	if c.PostForm("all") != "" {
+		paths = nil
+	} else if len(paths) == 0 {
+		id = ""
+	}
+	if id == "" {
+		c.String(http.StatusBadRequest, "缺少规则或文件路径")
+		return
+	}
+	if _, err := s.st.RequeueDead(ctx, id, paths); err != nil {
+		c.String(http.StatusInternalServerError, "操作失败：%v", err)
+		return
+	}
+	s.redirect(c, "/rules/dead?id="+url.QueryEscape(id))
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"115togd/internal/store"
+)
+
+// parseGroupFallbacks parses the fallback textarea of a limit group, in priority order.
+// One remote per line: "remote" or "remote | 750G" (no limit when the size is omitted or 0).
+func parseGroupFallbacks(raw string) ([]store.LimitGroupFallback, error) {
+	var out []store.LimitGroupFallback
+	seen := map[string]bool{}
+	for i, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		remote, size, _ := strings.Cut(line, "|")
+		remote = strings.TrimSuffix(strings.TrimSpace(remote), ":")
+		if remote == "" || strings.ContainsAny(remote, ": ") {
+			return nil, fmt.Errorf("第 %d 行格式错误：%q（示例：gd2 | 750G）", i+1, line)
+		}
+		if seen[remote] {
+			return nil, fmt.Errorf("第 %d 行重复的 remote：%s", i+1, remote)
+		}
+		seen[remote] = true
+		limit, err := parseSizeBytes(size)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行流量限制格式错误：%v", i+1, err)
+		}
+		out = append(out, store.LimitGroupFallback{DstRemote: remote, DailyLimitBytes: limit})
+	}
+	return out, nil
+}
+
+func formatGroupFallbacks(fbs []store.LimitGroupFallback) string {
+	var b strings.Builder
+	for _, fb := range fbs {
+		b.WriteString(fb.DstRemote)
+		if fb.DailyLimitBytes > 0 {
+			b.WriteString(" | " + humanBytes(fb.DailyLimitBytes))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
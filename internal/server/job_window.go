@@ -0,0 +1,37 @@
+package server
+
+import (
+	"time"
+
+	"115togd/internal/store"
+)
+
+// ruleWindow summarizes a rule's job window for the dashboard.
+type ruleWindow struct {
+	Scheduled bool      // the rule has a job_schedule
+	Open      bool      // jobs may start now
+	Next      time.Time // when the window next closes (Open) or opens; zero if not within a week
+}
+
+func ruleWindowAt(rule store.Rule, now time.Time) ruleWindow {
+	sched, err := store.ParseSchedule(rule.JobSchedule)
+	if err != nil || sched == nil {
+		return ruleWindow{Open: true}
+	}
+	w := ruleWindow{Scheduled: true, Open: sched.Active(now)}
+	w.Next, _ = sched.NextChange(now)
+	return w
+}
+
+// windowTime formats a window boundary relative to now: "15:04" today, "周五 15:04" within a week.
+func windowTime(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	y1, m1, d1 := t.Date()
+	y2, m2, d2 := now.Date()
+	if y1 == y2 && m1 == m2 && d1 == d2 {
+		return t.Format("15:04")
+	}
+	return [...]string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}[t.Weekday()] + " " + t.Format("15:04")
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"115togd/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quotaStat is a weekly or monthly quota of a limit group on the dashboard.
+type quotaStat struct {
+	Name  string // "week" or "month"
+	Usage int64
+	Limit int64
+	Reset string
+}
+
+// Label returns the Chinese name of the period.
+func (q quotaStat) Label() string {
+	if q.Name == "month" {
+		return "本月"
+	}
+	return "本周"
+}
+
+// resetTime formats a quota reset relative to now (both in the group's time zone): like
+// windowTime within a week, "01-02 15:04" further out; "" for rolling windows.
+func resetTime(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	if t.Sub(now) >= 6*24*time.Hour {
+		return t.Format("01-02 15:04")
+	}
+	return windowTime(t, now)
+}
+
+// limitInput formats a byte limit for the limit group form ("" when unlimited).
+func limitInput(n int64) string {
+	if n <= 0 {
+		return ""
+	}
+	return humanBytes(n)
+}
+
+// quotaPauseView is a provider quota pause on the dashboard.
+type quotaPauseView struct {
+	Scope  string
+	Remote string // fallback remote of a group pause; "" for the group's own destinations
+	Until  string
+	Reason string
+}
+
+func newQuotaPauseView(p store.QuotaPause, now time.Time) quotaPauseView {
+	return quotaPauseView{Scope: p.Scope, Until: resetTime(p.Until, now), Reason: p.Reason}
+}
+
+// groupQuotaPauses returns the pauses of a limit group, its own destinations first.
+func groupQuotaPauses(pauses map[string]store.QuotaPause, group string, now time.Time) []quotaPauseView {
+	own := store.GroupQuotaScope(group, "")
+	var out []quotaPauseView
+	for scope, p := range pauses {
+		switch {
+		case scope == own:
+			out = append(out, newQuotaPauseView(p, now))
+		case strings.HasPrefix(scope, own+":"):
+			v := newQuotaPauseView(p, now)
+			v.Remote = strings.TrimPrefix(scope, own+":")
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Remote < out[j].Remote })
+	return out
+}
+
+func (s *Server) quotaPauseClearPost(c *gin.Context) {
+	ctx := c.Request.Context()
+	scope := strings.TrimSpace(c.PostForm("scope"))
+	if scope == "" {
+		c.String(http.StatusBadRequest, "缺少 scope")
+		return
+	}
+	if err := s.st.ClearQuotaPause(ctx, scope); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.redirect(c, "/")
+}
+
+// serviceAccountStat is one service account of a limit group on the dashboard.
+type serviceAccountStat struct {
+	Name      string
+	Usage     int64
+	Limit     int64
+	Pause     *quotaPauseView
+	Available bool
+}
+
+func (s *Server) serviceAccountStats(ctx context.Context, lg store.LimitGroup, pauses map[string]store.QuotaPause, now time.Time) []serviceAccountStat {
+	accounts, err := store.ListServiceAccounts(lg.ServiceAccountDir)
+	if err != nil {
+		return nil
+	}
+	since := lg.QuotaPeriods(now)[0].Since
+	out := make([]serviceAccountStat, 0, len(accounts))
+	for _, name := range accounts {
+		a := serviceAccountStat{Name: name, Limit: lg.ServiceAccountLimitBytes}
+		a.Usage, _ = s.st.ServiceAccountBudgetSince(ctx, lg.Name, name, since)
+		if p, ok := pauses[store.ServiceAccountScope(lg.Name, name)]; ok {
+			v := newQuotaPauseView(p, now)
+			a.Pause = &v
+		}
+		a.Available = a.Pause == nil && (a.Limit <= 0 || a.Usage < a.Limit)
+		out = append(out, a)
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"115togd/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fileLineageGet shows how one file moved through a rule pipeline.
+func (s *Server) fileLineageGet(c *gin.Context) {
+	ctx := c.Request.Context()
+	ruleID := strings.TrimSpace(c.Query("rule_id"))
+	p := strings.TrimSpace(c.Query("path"))
+	rules, _ := s.st.ListRules(ctx)
+	data := map[string]any{
+		"Active": "rules",
+		"Rules":  rules,
+		"RuleID": ruleID,
+		"Path":   p,
+	}
+	if ruleID != "" && p != "" {
+		nodes, err := s.st.FileLineage(ctx, ruleID, p)
+		data["Nodes"] = nodes
+		data["Searched"] = true
+		data["Error"] = errString(err)
+		if err == nil {
+			events, err := s.st.ListFileEvents(ctx, ruleID, p, 0)
+			data["Events"] = events
+			data["Error"] = errString(err)
+		}
+	}
+	s.render(c, "file_lineage", data)
+}
+
+// apiFileEvents returns the transfer history of one file:
+// GET /api/files/events?rule_id=...&path=...[&limit=n] -> {"events": [...]}.
+func (s *Server) apiFileEvents(c *gin.Context) {
+	ruleID := strings.TrimSpace(c.Query("rule_id"))
+	p := strings.Trim(strings.TrimSpace(c.Query("path")), "/")
+	if ruleID == "" || p == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "rule_id and path required"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	events, err := s.st.ListFileEvents(c.Request.Context(), ruleID, p, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	if events == nil {
+		events = []store.FileEvent{}
+	}
+	c.JSON(http.StatusOK, map[string]any{"events": events})
+}
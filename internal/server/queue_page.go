@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ruleQueueGet lists the files a rule will transfer next, in queue order.
+func (s *Server) ruleQueueGet(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := strings.TrimSpace(c.Query("id"))
+	rule, ok, err := s.st.GetRule(ctx, id)
+	if err != nil || !ok {
+		c.String(http.StatusNotFound, "规则不存在")
+		return
+	}
+	const limit = 200
+	entries, err := s.st.ListRuleQueue(ctx, rule, limit)
+	s.render(c, "rule_queue", map[string]any{
+		"Active":  "rules",
+		"Rule":    rule,
+		"Entries": entries,
+		"Limit":   limit,
+		"Error":   errString(err),
+	})
+}
+
+// ruleQueuePinPost pins (or unpins) the posted paths; "paths" may repeat or hold one path per line.
+func (s *Server) ruleQueuePinPost(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := strings.TrimSpace(c.PostForm("id"))
+	paths := splitPaths(c.PostFormArray("paths"))
+	if id == "" || len(paths) == 0 {
+		c.String(http.StatusBadRequest, "缺少规则或文件路径")
+		return
+	}
+	if _, err := s.st.PinFiles(ctx, id, paths, c.PostForm("action") != "unpin"); err != nil {
+		c.String(http.StatusInternalServerError, "操作失败：%v", err)
+		return
+	}
+	s.redirect(c, "/rules/queue?id="+url.QueryEscape(id))
+}
+
+// apiRuleQueuePin is the JSON form of ruleQueuePinPost:
+// {"rule_id": "...", "paths": ["a.mkv"], "unpin": false} -> {"changed": n}.
+func (s *Server) apiRuleQueuePin(c *gin.Context) {
+	var req struct {
+		RuleID string   `json:"rule_id"`
+		Paths  []string `json:"paths"`
+		Unpin  bool     `json:"unpin"`
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": fmt.Sprintf("invalid json: %v", err)})
+		return
+	}
+	paths := splitPaths(req.Paths)
+	if strings.TrimSpace(req.RuleID) == "" || len(paths) == 0 {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "rule_id and paths required"})
+		return
+	}
+	n, err := s.st.PinFiles(c.Request.Context(), strings.TrimSpace(req.RuleID), paths, !req.Unpin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]any{"changed": n})
+}
+
+func splitPaths(in []string) []string {
+	var out []string
+	for _, v := range in {
+		for _, p := range strings.Split(v, "\n") {
+			if p = strings.Trim(strings.TrimSpace(p), "/"); p != "" {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
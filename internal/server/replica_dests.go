@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"115togd/internal/store"
+)
+
+// parseReplicaDests parses the extra destinations textarea of a fan-out rule.
+// One destination per line: "remote:/path" or "remote:/path | limit_group".
+func parseReplicaDests(raw string) ([]store.ReplicaDest, error) {
+	var out []store.ReplicaDest
+	for i, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		target, group, _ := strings.Cut(line, "|")
+		remote, p, ok := strings.Cut(strings.TrimSpace(target), ":")
+		if !ok || strings.TrimSpace(remote) == "" || strings.TrimSpace(p) == "" {
+			return nil, fmt.Errorf("第 %d 行格式错误：%q（示例：gd2:/Backup/A | 分组名）", i+1, line)
+		}
+		out = append(out, store.ReplicaDest{
+			DstRemote:  strings.TrimSpace(remote),
+			DstPath:    strings.TrimSpace(p),
+			LimitGroup: strings.TrimSpace(group),
+		})
+	}
+	return out, nil
+}
+
+func formatReplicaDests(replicas []store.Rule) string {
+	var b strings.Builder
+	for _, r := range replicas {
+		b.WriteString(r.DstRemote + ":" + r.DstPath)
+		if r.LimitGroup != "" {
+			b.WriteString(" | " + r.LimitGroup)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
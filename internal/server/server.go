@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
 	"html/template"
@@ -107,16 +108,27 @@ func New(st *store.Store, supervisor *daemon.Supervisor, logDir string, appLogPa
 	r.POST("/rules/delete", s.ruleDeletePost)
 	r.POST("/rules/toggle", s.ruleTogglePost)
 	r.POST("/rules/scan", s.ruleScanPost)
+	r.POST("/rules/reconcile", s.ruleReconcilePost)
 	r.POST("/rules/retry_failed", s.ruleRetryFailedPost)
+	r.GET("/rules/queue", s.ruleQueueGet)
+	r.POST("/rules/queue/pin", s.ruleQueuePinPost)
+	r.POST("/api/rule/queue/pin", s.apiRuleQueuePin)
+	r.GET("/rules/dead", s.ruleDeadGet)
+	r.POST("/rules/dead/requeue", s.ruleDeadRequeuePost)
+	r.GET("/rules/cleanup", s.ruleCleanupGet)
 
 	r.GET("/limit_groups", s.limitGroupsList)
 	r.POST("/limit_groups/save", s.limitGroupsSavePost)
 	r.POST("/limit_groups/delete", s.limitGroupsDeletePost)
+	r.POST("/quota_pauses/clear", s.quotaPauseClearPost)
 
 	r.GET("/extension_presets", s.extensionPresetsList)
 	r.POST("/extension_presets/save", s.extensionPresetsSavePost)
 	r.POST("/extension_presets/delete", s.extensionPresetsDeletePost)
 
+	r.GET("/files/lineage", s.fileLineageGet)
+	r.GET("/api/files/events", s.apiFileEvents)
+
 	r.GET("/manual", s.manualGet)
 	r.POST("/manual/start", s.manualStartPost)
 
@@ -171,10 +183,12 @@ func (s *Server) dashboard(c *gin.Context) {
 		groupUsage := map[string]int64{}
 		groupLimit := map[string]int64{}
 		
+	pauses, _ := s.st.ListQuotaPauses(ctx, time.Now())
 	lgs, _ := s.st.ListLimitGroups(ctx)
 	for _, lg := range lgs {
-		groupLimit[lg.Name] = lg.DailyLimitBytes
-		u, _ := s.st.GroupUsageSince(ctx, lg.Name, time.Now().Add(-24*time.Hour))
+		day := lg.QuotaPeriods(time.Now())[0]
+		groupLimit[lg.Name] = day.Limit
+		u, _ := s.st.GroupUsageSince(ctx, lg.Name, day.Since)
 		groupUsage[lg.Name] = u
 	}
 
@@ -183,6 +197,10 @@ func (s *Server) dashboard(c *gin.Context) {
 		Counts store.FileStateCounts
 		Usage24h int64
 		GroupLimit int64
+		Window   ruleWindow
+		WindowAt string
+		// Pause is set while an ungrouped rule waits out a provider quota error.
+		Pause    *quotaPauseView
 	}
 	var rows []ruleRow
 	for _, rule := range rules {
@@ -196,7 +214,13 @@ func (s *Server) dashboard(c *gin.Context) {
 			usage, _ = s.st.RuleUsageSince(ctx, rule.ID, time.Now().Add(-24*time.Hour))
 			limit = rule.DailyLimitBytes
 		}
-		rows = append(rows, ruleRow{Rule: rule, Counts: counts, Usage24h: usage, GroupLimit: limit})
+		win := ruleWindowAt(rule, time.Now())
+		row := ruleRow{Rule: rule, Counts: counts, Usage24h: usage, GroupLimit: limit, Window: win, WindowAt: windowTime(win.Next, time.Now())}
+		if p, ok := pauses[store.RuleQuotaScope(rule.ID)]; ok && rule.LimitGroup == "" {
+			v := newQuotaPauseView(p, time.Now())
+			row.Pause = &v
+		}
+		rows = append(rows, row)
 	}
 	var enabledRows []ruleRow
 	for _, row := range rows {
@@ -243,16 +267,46 @@ func (s *Server) dashboard(c *gin.Context) {
 		Name  string
 		Usage int64
 		Limit int64
+		// Fixed is set for calendar resets; NextReset is then the next daily reset.
+		Fixed     bool
+		NextReset string
+		Timezone  string
+		Periods   []quotaStat
+		// Files and FileLimit are the day's file count (done and in flight) and its cap.
+		Files     int64
+		FileLimit int64
+		// Pauses are provider quota pauses of the group and its fallbacks.
+		Pauses    []quotaPauseView
+		// Accounts lists the service accounts of the group (nil without a service-account dir).
+		Accounts  []serviceAccountStat
+		AccountsOK int
 	}
 	var groupStats []groupStat
 	lgs, _ = s.st.ListLimitGroups(ctx)
 	for _, lg := range lgs {
-		usage, _ := s.st.GroupUsageSince(ctx, lg.Name, now.Add(-24*time.Hour))
-		groupStats = append(groupStats, groupStat{
-			Name:  lg.Name,
-			Usage: usage,
-			Limit: lg.DailyLimitBytes,
-		})
+		st := groupStat{Name: lg.Name, Fixed: lg.ResetMode == "fixed", Timezone: lg.Location().String(), Pauses: groupQuotaPauses(pauses, lg.Name, now)}
+		for i, p := range lg.QuotaPeriods(now) {
+			usage, _ := s.st.GroupUsageSince(ctx, lg.Name, p.Since)
+			if i == 0 {
+				st.Usage, st.Limit = usage, p.Limit
+				st.NextReset = resetTime(p.Reset, now.In(p.Since.Location()))
+				if lg.DailyLimitFiles > 0 {
+					st.FileLimit = lg.DailyLimitFiles
+					st.Files, _ = s.st.GroupFileBudgetSince(ctx, lg.Name, p.Since)
+				}
+				continue
+			}
+			st.Periods = append(st.Periods, quotaStat{Name: p.Name, Usage: usage, Limit: p.Limit, Reset: resetTime(p.Reset, now.In(p.Since.Location()))})
+		}
+		if lg.ServiceAccountDir != "" {
+			st.Accounts = s.serviceAccountStats(ctx, lg, pauses, now)
+			for _, a := range st.Accounts {
+				if a.Available {
+					st.AccountsOK++
+				}
+			}
+		}
+		groupStats = append(groupStats, st)
 	}
 
 	settings, _ := s.st.RuntimeSettings(ctx)
@@ -295,17 +349,37 @@ func (s *Server) remotesList(c *gin.Context) {
 func (s *Server) rulesList(c *gin.Context) {
 	ctx := c.Request.Context()
 	rules, _ := s.st.ListRules(ctx)
+	type replicaRow struct {
+		Rule   store.Rule
+		Counts store.FileStateCounts
+	}
 	type ruleRow struct {
 		Rule   store.Rule
 		Counts store.FileStateCounts
 		Usage24h int64
+		Replicas []replicaRow
+		AllDone  int
+		// Reconcile is the last reconciliation with the destination (zero At = never).
+		Reconcile store.DestReconcile
+		Scan      store.ScanProgress
 	}
 
 	var rows []ruleRow
 	for _, rule := range rules {
 		counts, _ := s.st.RuleFileCounts(ctx, rule.ID)
 		usage, _ := s.st.RuleUsageSince(ctx, rule.ID, time.Now().Add(-24*time.Hour))
-		rows = append(rows, ruleRow{Rule: rule, Counts: counts, Usage24h: usage})
+		row := ruleRow{Rule: rule, Counts: counts, Usage24h: usage}
+		row.Reconcile, _, _ = s.st.GetDestReconcile(ctx, rule.ID)
+		row.Scan, _, _ = s.st.GetScanProgress(ctx, rule.ID)
+		replicas, _ := s.st.ListReplicas(ctx, rule.ID)
+		for _, r := range replicas {
+			rc, _ := s.st.RuleFileCounts(ctx, r.ID)
+			row.Replicas = append(row.Replicas, replicaRow{Rule: r, Counts: rc})
+		}
+		if len(replicas) > 0 {
+			row.AllDone, _ = s.st.FanoutDoneCount(ctx, rule.ID)
+		}
+		rows = append(rows, row)
 	}
 	s.render(c, "rules", map[string]any{
 		"Active": "rules",
@@ -319,12 +393,17 @@ func (s *Server) ruleEditGet(c *gin.Context) {
 	copyFromID := strings.TrimSpace(c.Query("copy_from_id"))
 
 	var rule store.Rule
+	var extraDests string
 	if id != "" {
 		if got, ok, _ := s.st.GetRule(ctx, id); ok {
 			rule = got
+			replicas, _ := s.st.ListReplicas(ctx, rule.ID)
+			extraDests = formatReplicaDests(replicas)
 		}
 	} else if copyFromID != "" {
 		if got, ok, _ := s.st.GetRule(ctx, copyFromID); ok {
+			replicas, _ := s.st.ListReplicas(ctx, got.ID)
+			extraDests = formatReplicaDests(replicas)
 			rule = got
 			rule.ID = ""       // Force new ID
 			rule.Enabled = false // Default to disabled for safety
@@ -338,8 +417,10 @@ func (s *Server) ruleEditGet(c *gin.Context) {
 		rule.TransferMode = "copy"
 		rule.MaxParallelJobs = 1
 		rule.ScanIntervalSec = 15
+		rule.ScanStrategy = "full"
 		rule.StableSeconds = 60
 		rule.BatchSize = 100
+		rule.MissingGraceScans = 2
 	}
 	remotes, err := s.listRcloneRemotes(ctx)
 	rules, _ := s.st.ListRules(ctx)
@@ -348,6 +429,7 @@ func (s *Server) ruleEditGet(c *gin.Context) {
 	s.render(c, "rule_edit", map[string]any{
 		"Active":  "rules",
 		"Rule":    rule,
+		"ExtraDestinations": extraDests,
 		"Remotes": remotes,
 		"Rules":   rules,
 		"LimitGroups": limitGroups,
@@ -369,11 +451,29 @@ func (s *Server) limitGroupsList(c *gin.Context) {
 		}
 	}
 
+	groupFallbacksMap := map[string]string{}
+	groupQuotaMap := map[string]map[string]string{}
+	for _, g := range groups {
+		groupFallbacksMap[g.Name] = formatGroupFallbacks(g.Fallbacks)
+		groupQuotaMap[g.Name] = map[string]string{
+			"files":      strconv.FormatInt(g.DailyLimitFiles, 10),
+			"sa_dir":     g.ServiceAccountDir,
+			"sa_limit":   limitInput(g.ServiceAccountLimitBytes),
+			"weekly":     limitInput(g.WeeklyLimitBytes),
+			"monthly":    limitInput(g.MonthlyLimitBytes),
+			"reset_mode": g.ResetMode,
+			"reset_time": g.ResetTime,
+			"timezone":   g.Timezone,
+		}
+	}
+
 	s.render(c, "limit_groups", map[string]any{
 		"Active": "rules", 
 		"Groups": groups,
 		"Rules": rules,
 		"GroupRulesMap": groupRulesMap,
+		"GroupFallbacksMap": groupFallbacksMap,
+		"GroupQuotaMap": groupQuotaMap,
 	})
 }
 
@@ -384,15 +484,63 @@ func (s *Server) limitGroupsSavePost(c *gin.Context) {
 		c.String(http.StatusBadRequest, "流量限制格式错误：%v", err)
 		return
 	}
+	var limitFiles int64
+	if v := strings.TrimSpace(c.PostForm("daily_limit_files")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			c.String(http.StatusBadRequest, "文件数限制格式错误")
+			return
+		}
+		limitFiles = n
+	}
+	saLimit, err := parseSizeBytes(c.PostForm("sa_daily_limit"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "服务账号限制格式错误：%v", err)
+		return
+	}
+	saDir := strings.TrimSpace(c.PostForm("sa_dir"))
+	if saDir != "" {
+		if _, err := store.ListServiceAccounts(saDir); err != nil {
+			c.String(http.StatusBadRequest, "服务账号目录无法读取：%v", err)
+			return
+		}
+	}
+	weekly, err := parseSizeBytes(c.PostForm("weekly_limit"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "每周限制格式错误：%v", err)
+		return
+	}
+	monthly, err := parseSizeBytes(c.PostForm("monthly_limit"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "每月限制格式错误：%v", err)
+		return
+	}
+	fallbacks, err := parseGroupFallbacks(c.PostForm("fallbacks"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "备用目标格式错误：%v", err)
+		return
+	}
 	name := strings.TrimSpace(c.PostForm("name"))
 	g := store.LimitGroup{
-		Name:            name,
-		DailyLimitBytes: limit,
+		Name:                     name,
+		DailyLimitBytes:          limit,
+		DailyLimitFiles:          limitFiles,
+		ServiceAccountDir:        saDir,
+		ServiceAccountLimitBytes: saLimit,
+		WeeklyLimitBytes:         weekly,
+		MonthlyLimitBytes:        monthly,
+		ResetMode:                c.PostForm("reset_mode"),
+		ResetTime:                c.PostForm("reset_time"),
+		Timezone:                 c.PostForm("timezone"),
 	}
 	if err := s.st.UpsertLimitGroup(ctx, g); err != nil {
 		c.String(http.StatusBadRequest, err.Error())
 		return
 	}
+	if err := s.st.SetLimitGroupFallbacks(ctx, name, fallbacks); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
 	
 	// Update associated rules
 	ruleIDs := c.PostFormArray("rule_ids")
@@ -430,6 +578,7 @@ func (s *Server) extensionPresetsSavePost(c *gin.Context) {
 	p := store.ExtensionPreset{
 		Name:       name,
 		Extensions: exts,
+		Filters:    c.PostForm("filters"),
 	}
 	if err := s.st.UpsertExtensionPreset(ctx, p); err != nil {
 		c.String(http.StatusBadRequest, err.Error())
@@ -557,6 +706,11 @@ func (s *Server) ruleSavePost(c *gin.Context) {
 		c.String(http.StatusBadRequest, "每日流量限制格式错误：%v（示例：750G / 0 / 留空）", err)
 		return
 	}
+	batchMaxBytes, err := parseSizeBytes(c.PostForm("batch_max_bytes"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "批大小上限格式错误：%v（示例：50G / 0 / 留空）", err)
+		return
+	}
 	if strings.TrimSpace(c.PostForm("rclone_extra_args")) != "" {
 		if _, err := daemon.ParseRcloneArgs(c.PostForm("rclone_extra_args")); err != nil {
 			c.String(http.StatusBadRequest, err.Error())
@@ -565,6 +719,7 @@ func (s *Server) ruleSavePost(c *gin.Context) {
 	}
 	rule := store.Rule{
 		ID:              c.PostForm("id"),
+		UpstreamRule:    c.PostForm("upstream_rule"),
 		LimitGroup:      strings.TrimSpace(c.PostForm("limit_group")),
 		SrcKind:         c.PostForm("src_kind"),
 		SrcRemote:       c.PostForm("src_remote"),
@@ -574,27 +729,75 @@ func (s *Server) ruleSavePost(c *gin.Context) {
 		DstRemote:       c.PostForm("dst_remote"),
 		DstPath:         c.PostForm("dst_path"),
 		TransferMode:    c.PostForm("transfer_mode"),
+		MaxDelete:       c.PostForm("max_delete"),
+		ConflictPolicy:  c.PostForm("conflict_policy"),
+		VerifyMode:      c.PostForm("verify_mode"),
 		RcloneExtraArgs: c.PostForm("rclone_extra_args"),
 		IgnoreExtensions: c.PostForm("ignore_extensions"),
+		Filters:         c.PostForm("filters"),
 		Bwlimit:         c.PostForm("bwlimit"),
+		JobSchedule:     c.PostForm("job_schedule"),
+		ScanSchedule:    c.PostForm("scan_schedule"),
+		WindowPolicy:    c.PostForm("window_policy"),
+		WindowBwlimit:   c.PostForm("window_bwlimit"),
 		DailyLimitBytes: dailyLimit,
 		MinFileSizeBytes: minSize,
 		MaxParallelJobs: atoiDefault(c.PostForm("max_parallel_jobs"), 1),
 		ScanIntervalSec: atoiDefault(c.PostForm("scan_interval_sec"), 15),
 		StableSeconds:   atoiDefault(c.PostForm("stable_seconds"), 60),
 		BatchSize:       atoiDefault(c.PostForm("batch_size"), 100),
+		BatchMaxBytes:   batchMaxBytes,
+		QueueOrder:      c.PostForm("queue_order"),
+		PriorityRules:   c.PostForm("priority_rules"),
+		MissingAction:   c.PostForm("missing_action"),
+		MissingGraceScans: atoiDefault(c.PostForm("missing_grace_scans"), 2),
+		SourceDeleteAfterDays: atoiDefault(c.PostForm("source_delete_after_days"), 0),
+		SourceDeleteWatermark: atoiDefault(c.PostForm("source_delete_watermark"), 0),
+		SourceTrashDir:    c.PostForm("source_trash_dir"),
+		SeedFromDest:      store.ParseEnabled(c.PostForm("seed_from_dest")),
+		ScanStrategy:      c.PostForm("scan_strategy"),
+		FullScanIntervalSec: atoiDefault(c.PostForm("full_scan_interval_sec"), 0),
 		Enabled:         store.ParseEnabled(c.PostForm("enabled")),
 	}
+	dests, err := parseReplicaDests(c.PostForm("extra_destinations"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "额外目标端%v", err)
+		return
+	}
+	if len(dests) > 0 && normalizeTransferMode(rule.TransferMode) != "copy" {
+		c.String(http.StatusBadRequest, "多目标复制仅支持 copy 模式")
+		return
+	}
+	if _, err := s.st.RuleFileFilter(ctx, rule); err != nil {
+		c.String(http.StatusBadRequest, "过滤规则错误：%v", err)
+		return
+	}
 	if err := s.st.UpsertRule(ctx, rule); err != nil {
 		c.String(http.StatusBadRequest, err.Error())
 		return
 	}
-	if !rule.Enabled && s.supervisor != nil {
-		s.supervisor.StopRule(rule.ID)
+	if err := s.st.SetRuleReplicas(ctx, rule, dests); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !rule.Enabled {
+		s.stopRuleWithReplicas(ctx, rule.ID)
 	}
 	s.redirect(c, "/rules")
 }
 
+// stopRuleWithReplicas stops the worker of a rule and of its fan-out replicas.
+func (s *Server) stopRuleWithReplicas(ctx context.Context, id string) {
+	if s.supervisor == nil {
+		return
+	}
+	s.supervisor.StopRule(id)
+	replicas, _ := s.st.ListReplicas(ctx, id)
+	for _, r := range replicas {
+		s.supervisor.StopRule(r.ID)
+	}
+}
+
 func (s *Server) ruleDeletePost(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.PostForm("id")
@@ -616,8 +819,8 @@ func (s *Server) ruleTogglePost(c *gin.Context) {
 		c.String(http.StatusBadRequest, err.Error())
 		return
 	}
-	if !enabled && s.supervisor != nil {
-		s.supervisor.StopRule(id)
+	if !enabled {
+		s.stopRuleWithReplicas(ctx, id)
 	}
 	s.redirect(c, "/rules")
 }
@@ -628,10 +831,25 @@ func (s *Server) ruleScanPost(c *gin.Context) {
 	s.redirect(c, "/rules")
 }
 
+// ruleReconcilePost has the rule's next scan reconcile its files with the destination; for a
+// replica the parent, which scans for it, does it.
+func (s *Server) ruleReconcilePost(c *gin.Context) {
+	id := c.PostForm("id")
+	if rule, ok, _ := s.st.GetRule(c.Request.Context(), id); ok && rule.ParentID != "" {
+		id = rule.ParentID
+	}
+	_ = s.supervisor.ReconcileDest(id)
+	s.redirect(c, "/rules")
+}
+
 func (s *Server) ruleRetryFailedPost(c *gin.Context) {
 	ctx := c.Request.Context()
 	id := c.PostForm("id")
 	_, _ = s.st.RetryFailed(ctx, id, 10000)
+	replicas, _ := s.st.ListReplicas(ctx, id)
+	for _, r := range replicas {
+		_, _ = s.st.RetryFailed(ctx, r.ID, 10000)
+	}
 	s.redirect(c, "/rules")
 }
 
@@ -711,7 +929,7 @@ func normalizeJobStatus(s string) string {
 
 func normalizeTransferMode(s string) string {
 	switch strings.TrimSpace(strings.ToLower(s)) {
-	case "copy", "move":
+	case "copy", "move", "sync", "bisync":
 		return strings.TrimSpace(strings.ToLower(s))
 	default:
 		return ""
@@ -763,10 +981,14 @@ func (s *Server) jobView(c *gin.Context) {
 		return
 	}
 	rule, _, _ := s.st.GetRule(ctx, job.RuleID)
+	conflicts, _ := s.st.ListJobConflicts(ctx, job.JobID)
+	verifyFailures, _ := s.st.ListJobVerifyFailures(ctx, job.JobID)
 	s.render(c, "job_view", map[string]any{
 		"Active": "jobs",
 		"Job":  job,
 		"Rule": rule,
+		"Conflicts": conflicts,
+		"VerifyFailures": verifyFailures,
 	})
 }
 
@@ -885,6 +1107,10 @@ func (s *Server) settingsSavePost(c *gin.Context) {
 		passwordChanged = true
 	}
 
+	if _, err := store.ParseBwlimit(c.PostForm("rclone_bwlimit")); err != nil {
+		c.String(http.StatusBadRequest, "bwlimit 格式错误：%v（示例：8M 或 08:00 1M, 23:00 off）", err)
+		return
+	}
 	for _, key := range []string{
 		"rclone_config_path",
 		"log_retention_days",
@@ -898,6 +1124,10 @@ func (s *Server) settingsSavePost(c *gin.Context) {
 		"rclone_bwlimit",
 		"metrics_interval_ms",
 		"scheduler_tick_ms",
+		"quota_cooldown_min",
+		"retry_max_attempts",
+		"retry_backoff_sec",
+		"file_event_retention_days",
 	} {
 		v := strings.TrimSpace(c.PostForm(key))
 		if key == "rclone_config_path" {
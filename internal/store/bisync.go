@@ -0,0 +1,132 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// BisyncListings returns both sides as recorded after the last successful bisync run.
+// Both maps are empty when the rule has never completed a run.
+func (s *Store) BisyncListings(ctx context.Context, ruleID string) (src, dst map[string]ScanEntry, err error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT side, path, size, mod_time
+FROM bisync_listings
+WHERE rule_id=?
+`, ruleID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	src = map[string]ScanEntry{}
+	dst = map[string]ScanEntry{}
+	for rows.Next() {
+		var side, mod string
+		var e ScanEntry
+		if err := rows.Scan(&side, &e.Path, &e.Size, &mod); err != nil {
+			return nil, nil, err
+		}
+		e.ModTime, _ = time.Parse(time.RFC3339, mod)
+		if side == "dst" {
+			dst[e.Path] = e
+		} else {
+			src[e.Path] = e
+		}
+	}
+	return src, dst, rows.Err()
+}
+
+// ReplaceBisyncListings stores both sides as the new baseline for the next bisync run.
+func (s *Store) ReplaceBisyncListings(ctx context.Context, ruleID string, src, dst []ScanEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM bisync_listings WHERE rule_id=?`, ruleID); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO bisync_listings(rule_id, side, path, size, mod_time)
+VALUES(?, ?, ?, ?, ?)
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for side, entries := range map[string][]ScanEntry{"src": src, "dst": dst} {
+		for _, e := range entries {
+			if _, err := stmt.ExecContext(ctx, ruleID, side, e.Path, e.Size, e.ModTime.UTC().Format(time.RFC3339)); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// JobConflict is a path changed on both sides of a bisync rule since the last run.
+type JobConflict struct {
+	JobID      string
+	Path       string
+	SrcSize    int64
+	SrcModTime time.Time
+	DstSize    int64
+	DstModTime time.Time
+	// Resolution is the side whose version won ("src"/"dst") or "keep_both".
+	Resolution string
+	// RenamedTo is where the losing destination version was kept for keep_both.
+	RenamedTo string
+}
+
+func (s *Store) InsertJobConflicts(ctx context.Context, jobID string, conflicts []JobConflict) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT OR REPLACE INTO job_conflicts(job_id, path, src_size, src_mod_time, dst_size, dst_mod_time, resolution, renamed_to)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range conflicts {
+		if _, err := stmt.ExecContext(ctx, jobID, c.Path,
+			c.SrcSize, c.SrcModTime.UTC().Format(time.RFC3339),
+			c.DstSize, c.DstModTime.UTC().Format(time.RFC3339),
+			c.Resolution, c.RenamedTo); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) ListJobConflicts(ctx context.Context, jobID string) ([]JobConflict, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT job_id, path, src_size, src_mod_time, dst_size, dst_mod_time, resolution, renamed_to
+FROM job_conflicts
+WHERE job_id=?
+ORDER BY path
+`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []JobConflict
+	for rows.Next() {
+		var c JobConflict
+		var srcMod, dstMod string
+		if err := rows.Scan(&c.JobID, &c.Path, &c.SrcSize, &srcMod, &c.DstSize, &dstMod, &c.Resolution, &c.RenamedTo); err != nil {
+			return nil, err
+		}
+		c.SrcModTime, _ = time.Parse(time.RFC3339, srcMod)
+		c.DstModTime, _ = time.Parse(time.RFC3339, dstMod)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A bwlimit (rule.bwlimit / setting rclone_bwlimit) is either a single rate ("8M", "off",
+// "10M:1M" for upload:download) or a timetable of "HH:MM rate" entries separated by newlines,
+// commas or spaces, e.g. "08:00 1M, 23:00 off" (rclone's "08:00,1M 23:00,off" works too).
+// Each entry applies from its time until the next one; before the first entry of the day the
+// last one still applies. The daemon pushes timetable changes into running jobs over rc.
+
+// BwlimitTimetable is a parsed bwlimit. A nil *BwlimitTimetable means no limit configured.
+type BwlimitTimetable struct {
+	static  string
+	entries []bwlimitEntry // sorted by at
+}
+
+type bwlimitEntry struct {
+	at   int // minutes since midnight
+	rate string
+}
+
+var (
+	bwlimitClockRe = regexp.MustCompile(`^\d{1,2}:\d{2}$`)
+	bwlimitRateRe  = regexp.MustCompile(`(?i)^(off|\d+(\.\d+)?([bkmgtp]i?b?)?)$`)
+)
+
+// ParseBwlimit parses a rate or a timetable; an empty value returns nil.
+func ParseBwlimit(raw string) (*BwlimitTimetable, error) {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	if len(fields) == 1 && !bwlimitClockRe.MatchString(fields[0]) {
+		if err := validateBwlimitRate(fields[0]); err != nil {
+			return nil, err
+		}
+		return &BwlimitTimetable{static: fields[0]}, nil
+	}
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("bwlimit timetable needs \"HH:MM rate\" pairs: %q", strings.TrimSpace(raw))
+	}
+	t := &BwlimitTimetable{}
+	seen := map[int]bool{}
+	for i := 0; i < len(fields); i += 2 {
+		if !bwlimitClockRe.MatchString(fields[i]) {
+			return nil, fmt.Errorf("bwlimit timetable: expected HH:MM, got %q", fields[i])
+		}
+		at, err := parseClock(fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("bwlimit timetable: %w", err)
+		}
+		if seen[at] {
+			return nil, fmt.Errorf("bwlimit timetable: %s listed twice", fields[i])
+		}
+		seen[at] = true
+		if err := validateBwlimitRate(fields[i+1]); err != nil {
+			return nil, err
+		}
+		t.entries = append(t.entries, bwlimitEntry{at: at, rate: fields[i+1]})
+	}
+	sort.Slice(t.entries, func(a, b int) bool { return t.entries[a].at < t.entries[b].at })
+	return t, nil
+}
+
+func validateBwlimitRate(rate string) error {
+	up, down, pair := strings.Cut(rate, ":")
+	if !bwlimitRateRe.MatchString(up) || (pair && !bwlimitRateRe.MatchString(down)) {
+		return fmt.Errorf("invalid bwlimit rate: %q", rate)
+	}
+	return nil
+}
+
+// RateAt returns the rate in effect at now ("" for a nil timetable).
+func (t *BwlimitTimetable) RateAt(now time.Time) string {
+	if t == nil {
+		return ""
+	}
+	if t.static != "" {
+		return t.static
+	}
+	mins := now.Hour()*60 + now.Minute()
+	rate := t.entries[len(t.entries)-1].rate
+	for _, e := range t.entries {
+		if e.at > mins {
+			break
+		}
+		rate = e.rate
+	}
+	return rate
+}
+
+// EffectiveBwlimit resolves the rate a job of rule should run with at now: the rule's bwlimit,
+// else the global one; "" when neither is set. Invalid values (saved before validation existed)
+// are passed through unchanged when they are a single rate.
+func EffectiveBwlimit(ruleBwlimit, globalBwlimit string, now time.Time) string {
+	for _, raw := range []string{ruleBwlimit, globalBwlimit} {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		t, err := ParseBwlimit(raw)
+		if err != nil {
+			if strings.ContainsAny(raw, " ,\n") {
+				continue
+			}
+			return raw
+		}
+		return t.RateAt(now)
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dst_path may contain placeholders resolved per file:
+//
+//	{yyyy} {mm} {dd} {HH}                  file mod time
+//	{scan_yyyy} {scan_mm} {scan_dd} {scan_HH}  time the scan last saw the file
+//	{dir1} {dir2} ...                      directory segments of the source path ("" when missing)
+//	{ext}                                  lower-case extension without the dot
+//
+// Any other {word} is literal text, so paths with braces in them keep working as before.
+// rclone keeps each file's source directories below the resolved dst_path (--files-from-raw), so
+// {dirN} would repeat them ("/{dir1}" puts Movies/x.mkv at /Movies/Movies/x.mkv); rules cannot
+// be saved with it (see ValidateDstPath), while rules saved before still resolve it.
+var dstPlaceholderRe = regexp.MustCompile(`\{([a-zA-Z_]+[0-9]*)\}`)
+
+var dstDirPlaceholderRe = regexp.MustCompile(`\{dir[0-9]+\}`)
+
+// ValidateDstPath rejects dst_path templates whose placeholders would nest the source
+// directories twice.
+func ValidateDstPath(dstPath string) error {
+	if m := dstDirPlaceholderRe.FindString(dstPath); m != "" {
+		return fmt.Errorf("dst_path placeholder %s is not supported: files keep their source directories below dst_path", m)
+	}
+	return nil
+}
+
+// HasDstPlaceholders reports whether dst_path is a template.
+func HasDstPlaceholders(dstPath string) bool {
+	for _, m := range dstPlaceholderRe.FindAllStringSubmatch(dstPath, -1) {
+		if _, ok := dstPlaceholderValue(m[1], "", time.Time{}, time.Time{}); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveDstPath fills the placeholders of dstPath for the file at rel (relative to the source root).
+func ResolveDstPath(dstPath, rel string, modTime, seenAt time.Time) string {
+	if !HasDstPlaceholders(dstPath) {
+		return dstPath
+	}
+	out := dstPlaceholderRe.ReplaceAllStringFunc(dstPath, func(tok string) string {
+		v, ok := dstPlaceholderValue(tok[1:len(tok)-1], rel, modTime, seenAt)
+		if !ok {
+			return tok
+		}
+		return strings.ReplaceAll(v, "/", "_")
+	})
+	return cleanRemotePath(out)
+}
+
+func dstPlaceholderValue(name, rel string, modTime, seenAt time.Time) (string, bool) {
+	modTime = modTime.Local()
+	seenAt = seenAt.Local()
+	switch name {
+	case "yyyy":
+		return modTime.Format("2006"), true
+	case "mm":
+		return modTime.Format("01"), true
+	case "dd":
+		return modTime.Format("02"), true
+	case "HH":
+		return modTime.Format("15"), true
+	case "scan_yyyy":
+		return seenAt.Format("2006"), true
+	case "scan_mm":
+		return seenAt.Format("01"), true
+	case "scan_dd":
+		return seenAt.Format("02"), true
+	case "scan_HH":
+		return seenAt.Format("15"), true
+	case "ext":
+		return strings.ToLower(strings.TrimPrefix(path.Ext(rel), ".")), true
+	}
+	if strings.HasPrefix(name, "dir") {
+		n, err := strconv.Atoi(strings.TrimPrefix(name, "dir"))
+		if err != nil || n <= 0 {
+			return "", false
+		}
+		dirs := strings.Split(path.Dir(rel), "/")
+		if path.Dir(rel) == "." || n > len(dirs) {
+			return "", true
+		}
+		return dirs[n-1], true
+	}
+	return "", false
+}
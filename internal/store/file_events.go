@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// fileEventTriggers record every state change of a file in file_events. Doing it in triggers
+// keeps the history complete no matter which query moved the file. Files removed by deleting
+// their rule are not recorded; DeleteRule drops the rule's history instead.
+const fileEventTriggers = `
+CREATE TRIGGER IF NOT EXISTS files_event_insert AFTER INSERT ON files
+BEGIN
+  INSERT INTO file_events(rule_id, path, at, event, state, job_id, size, error)
+  VALUES (NEW.rule_id, NEW.path, CAST(strftime('%s','now') AS INTEGER), 'seen', NEW.state, COALESCE(NEW.job_id, ''), NEW.size, '');
+END;
+
+CREATE TRIGGER IF NOT EXISTS files_event_update AFTER UPDATE OF state, fail_count ON files
+WHEN NEW.state != OLD.state OR NEW.fail_count > OLD.fail_count
+BEGIN
+  INSERT INTO file_events(rule_id, path, at, event, state, job_id, size, error)
+  VALUES (
+    NEW.rule_id, NEW.path, CAST(strftime('%s','now') AS INTEGER),
+    CASE
+      WHEN NEW.state='dead' THEN 'dead'
+      WHEN NEW.fail_count > OLD.fail_count THEN 'failed'
+      WHEN NEW.state='new' THEN 'seen'
+      WHEN NEW.state='transferring' THEN 'claimed'
+      ELSE NEW.state
+    END,
+    NEW.state,
+    COALESCE(NULLIF(NEW.job_id, ''), OLD.job_id, ''),
+    NEW.size,
+    CASE WHEN NEW.last_error != OLD.last_error THEN NEW.last_error ELSE '' END
+  );
+END;
+
+CREATE TRIGGER IF NOT EXISTS files_event_delete AFTER DELETE ON files
+WHEN EXISTS (SELECT 1 FROM rules WHERE id=OLD.rule_id)
+BEGIN
+  INSERT INTO file_events(rule_id, path, at, event, state, job_id, size, error)
+  VALUES (OLD.rule_id, OLD.path, CAST(strftime('%s','now') AS INTEGER), 'deleted', OLD.state, COALESCE(OLD.job_id, ''), OLD.size, '');
+END;
+`
+
+// FileEvent is one entry of a file's transfer history: seen, stable, queued, claimed, done,
+// failed, dead, verified, missing or deleted, and source_deleted / source_trashed once the
+// source copy was cleaned up.
+type FileEvent struct {
+	At    time.Time `json:"at"`
+	Event string    `json:"event"`
+	State string    `json:"state"`
+	JobID string    `json:"job_id,omitempty"`
+	Size  int64     `json:"size"`
+	Error string    `json:"error,omitempty"`
+}
+
+// ListFileEvents returns up to limit of the latest events of a file, oldest first.
+func (s *Store) ListFileEvents(ctx context.Context, ruleID, p string, limit int) ([]FileEvent, error) {
+	if limit <= 0 {
+		limit = 500
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT at, event, state, job_id, size, error
+FROM (
+  SELECT id, at, event, state, job_id, size, error
+  FROM file_events
+  WHERE rule_id=? AND path=?
+  ORDER BY id DESC
+  LIMIT ?
+)
+ORDER BY id ASC
+`, ruleID, p, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []FileEvent
+	for rows.Next() {
+		var e FileEvent
+		var at int64
+		if err := rows.Scan(&at, &e.Event, &e.State, &e.JobID, &e.Size, &e.Error); err != nil {
+			return nil, err
+		}
+		e.At = time.Unix(at, 0)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// PruneFileEvents deletes events older than before and returns how many were removed.
+func (s *Store) PruneFileEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM file_events WHERE at < ?`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -2,9 +2,8 @@ package store
 
 import (
 	"context"
-	// "database/sql"
+	"database/sql"
 	"errors"
-	"strings"
 	"time"
 )
 
@@ -14,7 +13,10 @@ type FileStateCounts struct {
 	Queued      int
 	Transferring int
 	Done        int
+	Verified    int
 	Failed      int
+	Dead        int
+	Missing     int
 }
 
 func (s *Store) RuleFileCounts(ctx context.Context, ruleID string) (FileStateCounts, error) {
@@ -46,8 +48,14 @@ GROUP BY state
 			c.Transferring = n
 		case "done":
 			c.Done = n
+		case "verified":
+			c.Verified = n
 		case "failed":
 			c.Failed = n
+		case "dead":
+			c.Dead = n
+		case "missing":
+			c.Missing = n
 		}
 	}
 	return c, rows.Err()
@@ -59,33 +67,83 @@ type ScanEntry struct {
 	ModTime time.Time
 }
 
+// UpsertScanEntries writes a listing of the rule's source in one transaction; scans stream
+// theirs through a ScanWriter instead.
 func (s *Store) UpsertScanEntries(ctx context.Context, rule Rule, entries []ScanEntry) error {
+	t, err := s.newScanTarget(ctx, rule)
+	if err != nil {
+		return err
+	}
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = tx.Rollback() }()
+	if err := t.upsert(ctx, tx, entries); err != nil {
+		return err
+	}
+	if err := t.finish(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// scanTarget is a rule that listed files are written into, with what it needs to do so.
+type scanTarget struct {
+	rule       Rule
+	filter     *FileFilter
+	priorities PriorityRules
+	// applied is the signature of the filter last applied to the rule's pending rows.
+	applied string
+}
+
+func (s *Store) newScanTarget(ctx context.Context, rule Rule) (scanTarget, error) {
+	filter, err := s.RuleFileFilter(ctx, rule)
+	if err != nil {
+		return scanTarget{}, err
+	}
+	priorities, err := ParsePriorityRules(rule.PriorityRules)
+	if err != nil {
+		return scanTarget{}, err
+	}
+	var applied string
+	if err := s.db.QueryRowContext(ctx, `SELECT filter_applied FROM rules WHERE id=?`, rule.ID).Scan(&applied); err != nil && err != sql.ErrNoRows {
+		return scanTarget{}, err
+	}
+	return scanTarget{rule: rule, filter: filter, priorities: priorities, applied: applied}, nil
+}
 
-	now := time.Now().Unix()
+// upsert records listed files of the rule and moves them through the new -> stable states.
+func (t scanTarget) upsert(ctx context.Context, tx *sql.Tx, entries []ScanEntry) error {
+	rule := t.rule
+	scanAt := time.Now()
+	now := scanAt.Unix()
 	stableSeconds := rule.StableSeconds
 	if stableSeconds < 0 {
 		stableSeconds = 0
 	}
 
 	stmt, err := tx.PrepareContext(ctx, `
-INSERT INTO files(rule_id, path, size, mod_time, state, last_seen, seen_size, seen_mod_time, job_id, fail_count, last_error)
-VALUES(?, ?, ?, ?, ?, ?, 0, '', NULL, 0, '')
+INSERT INTO files(rule_id, path, size, mod_time, state, last_seen, seen_size, seen_mod_time, job_id, fail_count, last_error, priority, first_seen)
+VALUES(?, ?, ?, ?, ?, ?, 0, '', NULL, 0, '', ?, ?)
 ON CONFLICT(rule_id, path) DO UPDATE SET
   seen_size=files.size,
   seen_mod_time=files.mod_time,
   size=excluded.size,
   mod_time=excluded.mod_time,
   last_seen=excluded.last_seen,
+  priority=excluded.priority,
+  missed_scans=0,
+  fail_count=CASE
+    WHEN files.state='dead' AND (excluded.size!=files.size OR excluded.mod_time!=files.mod_time) THEN 0
+    ELSE files.fail_count
+  END,
   state=CASE
     WHEN files.state='transferring' THEN files.state
     WHEN files.state='queued' THEN files.state
-    WHEN files.state='done' AND (excluded.size!=files.size OR excluded.mod_time!=files.mod_time) THEN 'new'
-    WHEN files.state='done' AND (excluded.size=files.size AND excluded.mod_time=files.mod_time) THEN 'done'
+    WHEN files.state='dead' AND excluded.size=files.size AND excluded.mod_time=files.mod_time THEN files.state
+    WHEN files.state IN ('done','verified') AND (excluded.size!=files.size OR excluded.mod_time!=files.mod_time) THEN 'new'
+    WHEN files.state IN ('done','verified') AND (excluded.size=files.size AND excluded.mod_time=files.mod_time) THEN files.state
     WHEN (excluded.size=files.size AND excluded.mod_time=files.mod_time) THEN 'stable'
     WHEN (strftime('%s','now') - strftime('%s', excluded.mod_time) > ?) THEN 'stable'
     ELSE 'new'
@@ -97,52 +155,67 @@ ON CONFLICT(rule_id, path) DO UPDATE SET
 	defer stmt.Close()
 
 	for _, e := range entries {
+		if !t.filter.Match(e.Path, e.Size, e.ModTime, scanAt) {
+			// Still seen: a transferred file that is filtered out now must not look deleted to sync.
+			if _, err := tx.ExecContext(ctx, `
+UPDATE files SET last_seen=? WHERE rule_id=? AND path=? AND state IN ('done','verified')
+`, now, rule.ID, e.Path); err != nil {
+				return err
+			}
+			continue
+		}
 		mod := e.ModTime.UTC().Format(time.RFC3339)
 		initialState := "new"
 		if time.Since(e.ModTime) > time.Duration(stableSeconds)*time.Second {
 			initialState = "stable"
 		}
-		if _, err := stmt.ExecContext(ctx, rule.ID, e.Path, e.Size, mod, initialState, now, stableSeconds); err != nil {
+		if _, err := stmt.ExecContext(ctx, rule.ID, e.Path, e.Size, mod, initialState, now, t.priorities.PriorityOf(e.Path), now, stableSeconds); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	if rule.MinFileSizeBytes > 0 {
-		if _, err := tx.ExecContext(ctx, `
-DELETE FROM files
-WHERE rule_id=? AND size < ? AND state IN ('new','stable','queued','failed')
-`, rule.ID, rule.MinFileSizeBytes); err != nil {
-			return err
-		}
+// finish drops the rule's pending files that its size limit or filters exclude by now.
+func (t scanTarget) finish(ctx context.Context, tx *sql.Tx) error {
+	if err := t.dropSmall(ctx, tx); err != nil {
+		return err
 	}
 
-	// When ignore_extensions is changed after running for a while, old rows may remain in queue.
-	// Delete ignored extensions for non-transferring states so they won't be written into files-from.
-	if exts := ParseIgnoreExtensions(rule.IgnoreExtensions); len(exts) > 0 {
-		var b strings.Builder
-		b.WriteString(`
-DELETE FROM files
-WHERE rule_id=? AND state IN ('new','stable','queued','failed') AND (`)
-		args := make([]any, 0, 1+len(exts)*2)
-		args = append(args, rule.ID)
-		for i, ext := range exts {
-			if i > 0 {
-				b.WriteString(" OR ")
-			}
-			// strict suffix match (case-insensitive via LOWER)
-			b.WriteString("substr(LOWER(path), ?) = ?")
-			args = append(args, -len(ext), ext)
-		}
-		b.WriteString(")\n")
-
-		if _, err := tx.ExecContext(ctx, b.String(), args...); err != nil {
+	// When the filters or ignore_extensions change after running for a while, old rows may remain
+	// in queue. Delete filtered-out rows in non-transferring states so they won't be written into files-from.
+	// Rows that passed an unchanged filter still pass it, unless it has age bounds.
+	sig := t.filter.Signature()
+	if sig == t.applied && !t.filter.timed() {
+		return nil
+	}
+	if t.filter != nil {
+		if err := dropFilteredFiles(ctx, tx, t.rule.ID, t.filter); err != nil {
 			return err
 		}
 	}
-	return tx.Commit()
+	if sig == t.applied {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `UPDATE rules SET filter_applied=? WHERE id=?`, sig, t.rule.ID)
+	return err
 }
 
-func (s *Store) EnqueueStable(ctx context.Context, ruleID string, limit int, minSizeBytes int64) (int64, error) {
+// dropSmall drops the rule's pending files below its minimum file size.
+func (t scanTarget) dropSmall(ctx context.Context, tx *sql.Tx) error {
+	if t.rule.MinFileSizeBytes <= 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+DELETE FROM files
+WHERE rule_id=? AND size < ? AND state IN ('new','stable','queued','failed','dead','missing')
+`, t.rule.ID, t.rule.MinFileSizeBytes)
+	return err
+}
+
+// EnqueueStable moves up to rule.BatchSize stable files into the queue, in the rule's queue order.
+func (s *Store) EnqueueStable(ctx context.Context, rule Rule) (int64, error) {
+	limit := rule.BatchSize
 	if limit <= 0 {
 		limit = 100
 	}
@@ -151,13 +224,13 @@ WITH cte AS (
   SELECT rowid
   FROM files
   WHERE rule_id=? AND state='stable' AND ( ?<=0 OR size>=? )
-  ORDER BY last_seen DESC
+  ORDER BY `+queueOrderBy(rule.QueueOrder)+`
   LIMIT ?
 )
 UPDATE files
 SET state='queued'
 WHERE rowid IN (SELECT rowid FROM cte)
-`, ruleID, minSizeBytes, minSizeBytes, limit)
+`, rule.ID, rule.MinFileSizeBytes, rule.MinFileSizeBytes, limit)
 	if err != nil {
 		return 0, err
 	}
@@ -169,9 +242,9 @@ func (s *Store) HasQueued(ctx context.Context, ruleID string) bool {
 	err := s.db.QueryRowContext(ctx, `
 SELECT 1
 FROM files
-WHERE rule_id=? AND state='queued'
+WHERE rule_id=? AND state='queued' AND next_attempt_at<=?
 LIMIT 1
-`, ruleID).Scan(&one)
+`, ruleID, nowUnix()).Scan(&one)
 	return err == nil && one == 1
 }
 
@@ -188,7 +261,7 @@ WITH cte AS (
   LIMIT ?
 )
 UPDATE files
-SET state='queued', last_error='', job_id=NULL
+SET state='queued', last_error='', error_permanent=0, job_id=NULL, next_attempt_at=0
 WHERE rowid IN (SELECT rowid FROM cte)
 `, ruleID, limit)
 	if err != nil {
@@ -197,52 +270,115 @@ WHERE rowid IN (SELECT rowid FROM cte)
 	return res.RowsAffected()
 }
 
-func (s *Store) ClaimQueuedForJob(ctx context.Context, rule Rule, jobID string, limit int) ([]string, error) {
+// ClaimedBatch is a group of claimed files that share one resolved destination path.
+type ClaimedBatch struct {
+	DstPath string
+	Paths   []string
+}
+
+// ClaimOptions controls which queued files a job claims and where they go.
+type ClaimOptions struct {
+	// Limit caps the number of files (default rule.BatchSize).
+	Limit int
+	// MaxBytes is a hard cap on the total size (remaining quota); files that do not fit are
+	// skipped so that smaller ones further down the queue can still go. 0 = no cap.
+	MaxBytes int64
+	// BatchBytes is a soft cap on the total size (rule.BatchMaxBytes): a single file larger
+	// than it is still claimed on its own. 0 = no cap.
+	BatchBytes int64
+	// DstRemote overrides the rule's destination remote (limit-group fallback).
+	DstRemote string
+}
+
+// claimScanFactor bounds how many queued rows a claim with a byte cap looks at, as a multiple
+// of the number of files it may claim.
+const claimScanFactor = 20
+
+// ClaimQueuedForJob marks queued files as transferring for jobID. Files are grouped by their
+// destination (dst_path placeholders resolved per file); the remote and resolved path each file
+// goes to are recorded in files.dst_remote / files.dst_path.
+func (s *Store) ClaimQueuedForJob(ctx context.Context, rule Rule, jobID string, opts ClaimOptions) ([]ClaimedBatch, error) {
+	limit := opts.Limit
 	if limit <= 0 {
 		limit = rule.BatchSize
 	}
+	dstRemote := opts.DstRemote
+	if dstRemote == "" {
+		dstRemote = rule.DstRemote
+	}
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer func() { _ = tx.Rollback() }()
 
+	// With a byte cap, files that do not fit are skipped, so the scan may go past limit rows,
+	// though not past claimScanFactor times as many; smaller files further down wait for a
+	// later claim.
+	rowLimit := limit
+	if opts.MaxBytes > 0 || opts.BatchBytes > 0 {
+		rowLimit = limit * claimScanFactor
+	}
 	rows, err := tx.QueryContext(ctx, `
-SELECT path
+SELECT path, size, mod_time, last_seen
 FROM files
-WHERE rule_id=? AND state='queued' AND (job_id IS NULL OR job_id='') AND ( ?<=0 OR size>=? )
-ORDER BY last_seen DESC
+WHERE rule_id=? AND state='queued' AND (job_id IS NULL OR job_id='') AND ( ?<=0 OR size>=? ) AND next_attempt_at<=?
+ORDER BY `+queueOrderBy(rule.QueueOrder)+`
 LIMIT ?
-`, rule.ID, rule.MinFileSizeBytes, rule.MinFileSizeBytes, limit)
+`, rule.ID, rule.MinFileSizeBytes, rule.MinFileSizeBytes, nowUnix(), rowLimit)
 	if err != nil {
 		return nil, err
 	}
-	var paths []string
-	for rows.Next() {
-		var p string
-		if err := rows.Scan(&p); err != nil {
+	var batches []ClaimedBatch
+	index := map[string]int{}
+	dstOf := map[string]string{}
+	var total int64
+	for len(dstOf) < limit && rows.Next() {
+		var p, mod string
+		var size, lastSeen int64
+		if err := rows.Scan(&p, &size, &mod, &lastSeen); err != nil {
 			_ = rows.Close()
 			return nil, err
 		}
-		paths = append(paths, p)
+		if (opts.MaxBytes > 0 && total >= opts.MaxBytes) || (opts.BatchBytes > 0 && total >= opts.BatchBytes) {
+			// The byte budget is used up; nothing further down can fit.
+			break
+		}
+		if opts.MaxBytes > 0 && total+size > opts.MaxBytes {
+			continue
+		}
+		if opts.BatchBytes > 0 && total+size > opts.BatchBytes && len(dstOf) > 0 {
+			continue
+		}
+		total += size
+		mt, _ := time.Parse(time.RFC3339, mod)
+		dst := ResolveDstPath(rule.DstPath, p, mt, time.Unix(lastSeen, 0))
+		i, ok := index[dst]
+		if !ok {
+			i = len(batches)
+			index[dst] = i
+			batches = append(batches, ClaimedBatch{DstPath: dst})
+		}
+		batches[i].Paths = append(batches[i].Paths, p)
+		dstOf[p] = dst
 	}
 	if err := rows.Close(); err != nil {
 		return nil, err
 	}
-	if len(paths) == 0 {
+	if len(batches) == 0 {
 		return nil, tx.Commit()
 	}
 
-	for _, p := range paths {
+	for p, dst := range dstOf {
 		if _, err := tx.ExecContext(ctx, `
 UPDATE files
-SET state='transferring', job_id=?
+SET state='transferring', job_id=?, dst_remote=?, dst_path=?
 WHERE rule_id=? AND path=? AND state='queued'
-`, jobID, rule.ID, p); err != nil {
+`, jobID, dstRemote, dst, rule.ID, p); err != nil {
 			return nil, err
 		}
 	}
-	return paths, tx.Commit()
+	return batches, tx.Commit()
 }
 
 func (s *Store) GetJobFilesSize(ctx context.Context, jobID string) (int64, error) {
@@ -270,11 +406,36 @@ WHERE job_id=?
 }
 
 // FinalizeJobFiles marks some paths as done, and updates remaining transferring files
-// of the job to either queued or failed.
+// of the job to either queued or failed; failed files go through the retry policy.
 func (s *Store) FinalizeJobFiles(ctx context.Context, jobID string, donePaths []string, remainingState string, errMsg string) error {
+	return s.finalizeJobFiles(ctx, jobID, donePaths, remainingState, errMsg, nil, true)
+}
+
+// FinalizeSkippedJobFiles is FinalizeJobFiles for paths rclone found already at the destination
+// and did not transfer; they do not count towards the limit groups' daily file counts.
+func (s *Store) FinalizeSkippedJobFiles(ctx context.Context, jobID string, donePaths []string) error {
+	return s.finalizeJobFiles(ctx, jobID, donePaths, "queued", "", nil, false)
+}
+
+// FailJobFiles is FinalizeJobFiles for a failed job whose log names the reason some files
+// failed: those files record their own error instead of errMsg, and permanent errors skip the
+// remaining retries.
+func (s *Store) FailJobFiles(ctx context.Context, jobID string, donePaths []string, errMsg string, fileErrs map[string]FileError) error {
+	return s.finalizeJobFiles(ctx, jobID, donePaths, "failed", errMsg, fileErrs, true)
+}
+
+func (s *Store) finalizeJobFiles(ctx context.Context, jobID string, donePaths []string, remainingState string, errMsg string, fileErrs map[string]FileError, transferred bool) error {
 	if remainingState != "queued" && remainingState != "failed" {
 		return errors.New("invalid remaining state: " + remainingState)
 	}
+	var policy RetryPolicy
+	if remainingState == "failed" {
+		settings, err := s.RuntimeSettings(ctx)
+		if err != nil {
+			return err
+		}
+		policy = settings.RetryPolicy()
+	}
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -284,36 +445,43 @@ func (s *Store) FinalizeJobFiles(ctx context.Context, jobID string, donePaths []
 	if len(donePaths) > 0 {
 		stmt, err := tx.PrepareContext(ctx, `
 UPDATE files
-SET state='done', last_error=''
+SET state='done', last_error='', error_permanent=0, pinned_at=0, done_at=?, done_unconfirmed=0, source_deleted_at=0
 WHERE job_id=? AND path=?
 `)
 		if err != nil {
 			return err
 		}
+		var n int64
+		doneAt := nowUnix()
 		for _, p := range donePaths {
-			if _, err := stmt.ExecContext(ctx, jobID, p); err != nil {
+			res, err := stmt.ExecContext(ctx, doneAt, jobID, p)
+			if err != nil {
 				_ = stmt.Close()
 				return err
 			}
+			k, _ := res.RowsAffected()
+			n += k
 		}
 		_ = stmt.Close()
+		// jobs.files_done feeds the limit groups' daily file counts.
+		if transferred {
+			if _, err := tx.ExecContext(ctx, `UPDATE jobs SET files_done=files_done+? WHERE job_id=?`, n, jobID); err != nil {
+				return err
+			}
+		}
 	}
 
 	switch remainingState {
 	case "queued":
 		if _, err := tx.ExecContext(ctx, `
 UPDATE files
-SET state='queued', job_id=NULL, last_error=''
+SET state='queued', job_id=NULL, last_error='', error_permanent=0
 WHERE job_id=? AND state='transferring'
 `, jobID); err != nil {
 			return err
 		}
 	case "failed":
-		if _, err := tx.ExecContext(ctx, `
-UPDATE files
-SET state='failed', last_error=?, fail_count=fail_count+1
-WHERE job_id=? AND state='transferring'
-`, errMsg, jobID); err != nil {
+		if err := failJobFiles(ctx, tx, jobID, errMsg, fileErrs, policy); err != nil {
 			return err
 		}
 	}
@@ -321,6 +489,67 @@ WHERE job_id=? AND state='transferring'
 	return tx.Commit()
 }
 
+// failJobFiles applies the retry policy to the files jobID still has transferring.
+func failJobFiles(ctx context.Context, tx *sql.Tx, jobID, errMsg string, fileErrs map[string]FileError, policy RetryPolicy) error {
+	rows, err := tx.QueryContext(ctx, `SELECT path, fail_count FROM files WHERE job_id=? AND state='transferring'`, jobID)
+	if err != nil {
+		return err
+	}
+	type failed struct {
+		path  string
+		count int
+	}
+	var list []failed
+	for rows.Next() {
+		var f failed
+		if err := rows.Scan(&f.path, &f.count); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		f.count++
+		list = append(list, f)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, f := range list {
+		fe, ok := fileErrs[f.path]
+		if !ok {
+			fe = FileError{Reason: errMsg}
+		}
+		if err := failFile(ctx, tx, jobID, f.path, f.count, fe, policy, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// failFile records the count-th failure of a file of jobID: it is queued again after the
+// policy's backoff, or becomes 'dead' (or 'failed' without automatic retries).
+func failFile(ctx context.Context, tx *sql.Tx, jobID, p string, count int, fe FileError, policy RetryPolicy, now time.Time) error {
+	permanent := 0
+	if fe.Permanent {
+		permanent = 1
+	}
+	var err error
+	switch {
+	case policy.MaxAttempts <= 0:
+		_, err = tx.ExecContext(ctx, `
+UPDATE files SET state='failed', last_error=?, error_permanent=?, fail_count=? WHERE job_id=? AND path=?
+`, fe.Reason, permanent, count, jobID, p)
+	case fe.Permanent || count >= policy.MaxAttempts:
+		_, err = tx.ExecContext(ctx, `
+UPDATE files SET state='dead', last_error=?, error_permanent=?, fail_count=? WHERE job_id=? AND path=?
+`, fe.Reason, permanent, count, jobID, p)
+	default:
+		_, err = tx.ExecContext(ctx, `
+UPDATE files SET state='queued', job_id=NULL, last_error=?, error_permanent=0, fail_count=?, next_attempt_at=? WHERE job_id=? AND path=?
+`, fe.Reason, count, now.Add(policy.Delay(count)).Unix(), jobID, p)
+	}
+	return err
+}
+
 func (s *Store) ReleaseTransferringBackToQueued(ctx context.Context, jobID string) error {
 	_, err := s.db.ExecContext(ctx, `
 UPDATE files
@@ -334,7 +563,7 @@ func (s *Store) ClearJobOnDone(ctx context.Context, jobID string) error {
 	_, err := s.db.ExecContext(ctx, `
 UPDATE files
 SET job_id=NULL
-WHERE job_id=? AND state='done'
+WHERE job_id=? AND state IN ('done','verified')
 `, jobID)
 	return err
 }
@@ -347,9 +576,9 @@ func (s *Store) CountRunningJobs(ctx context.Context, ruleID string) (int, error
 
 func (s *Store) CreateJobRow(ctx context.Context, j Job) error {
 	_, err := s.db.ExecContext(ctx, `
-INSERT INTO jobs(job_id, rule_id, transfer_mode, rc_port, started_at, status, log_path)
-VALUES(?, ?, ?, ?, ?, 'running', ?)
-`, j.JobID, j.RuleID, j.TransferMode, j.RcPort, j.StartedAt.Unix(), j.LogPath)
+INSERT INTO jobs(job_id, rule_id, transfer_mode, rc_port, started_at, status, log_path, dst_remote, service_account)
+VALUES(?, ?, ?, ?, ?, 'running', ?, ?, ?)
+`, j.JobID, j.RuleID, j.TransferMode, j.RcPort, j.StartedAt.Unix(), j.LogPath, j.DstRemote, j.ServiceAccount)
 	return err
 }
 
@@ -396,3 +625,65 @@ WHERE job_id=?
 `, nowUnix(), reason, bytesDone, avgSpeed, jobID)
 	return err
 }
+
+// SyncDeletionCandidates returns done paths that were not seen by the scan started at seenSince.
+// For sync rules these are written into files-from so rclone propagates the deletion to the destination.
+// Files reconcile marked done by size alone are left out unless verified since, as in source cleanup.
+func (s *Store) SyncDeletionCandidates(ctx context.Context, ruleID string, seenSince time.Time) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT path
+FROM files
+WHERE rule_id=? AND state IN ('done','verified') AND last_seen < ?
+  AND (done_unconfirmed=0 OR state='verified')
+ORDER BY path
+`, ruleID, seenSince.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// CountSeenSince counts the rule's files listed by the scan started at seenSince.
+func (s *Store) CountSeenSince(ctx context.Context, ruleID string, seenSince time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM files WHERE rule_id=? AND last_seen >= ?`, ruleID, seenSince.Unix()).Scan(&n)
+	return n, err
+}
+
+func (s *Store) CountRuleFiles(ctx context.Context, ruleID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM files WHERE rule_id=?`, ruleID).Scan(&n)
+	return n, err
+}
+
+func (s *Store) DeleteRuleFiles(ctx context.Context, ruleID string, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, `DELETE FROM files WHERE rule_id=? AND path=?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range paths {
+		if _, err := stmt.ExecContext(ctx, ruleID, p); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,375 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rule.filters holds one filter per line; '#' starts a comment:
+//
+//	- *.tmp          exclude a glob; without a leading '/' it matches at any directory depth
+//	+ /Movies/**     include a glob anchored at the source root ('**' spans directories)
+//	- re:\.part\d+$  exclude paths matching a regular expression
+//	- dir:cache      exclude everything below a directory
+//	min_size 1M      size bounds (K/M/G/T, binary units)
+//	max_size 20G
+//	min_age 10m      mod time bounds (Go durations plus d/w)
+//	max_age 30d
+//	preset:name      splice in the filters of a named preset
+//
+// The first matching +/- line decides. A path no line matches is included, unless the filter
+// has include lines, in which case it is excluded. Filters are applied to scan results before
+// they reach the files table, so files-from lists only ever contain matching paths.
+
+// FileFilter is a compiled rule filter. A nil *FileFilter matches everything.
+type FileFilter struct {
+	// src is the text the filter was compiled from, presets included (see Signature).
+	src        string
+	lines      []filterLine
+	hasInclude bool
+	minSize    int64
+	maxSize    int64
+	minAge     time.Duration
+	maxAge     time.Duration
+}
+
+type filterLine struct {
+	include bool
+	re      *regexp.Regexp
+	dir     string
+	suffix  string
+}
+
+func (l filterLine) match(p string) bool {
+	switch {
+	case l.suffix != "":
+		return strings.HasSuffix(strings.ToLower(p), l.suffix)
+	case l.dir != "":
+		return strings.HasPrefix(p, l.dir+"/")
+	default:
+		return l.re.MatchString(p)
+	}
+}
+
+// Match reports whether the file at p (relative to the source root) passes the filter.
+func (f *FileFilter) Match(p string, size int64, modTime, now time.Time) bool {
+	if f == nil {
+		return true
+	}
+	if f.minSize > 0 && size < f.minSize {
+		return false
+	}
+	if f.maxSize > 0 && size > f.maxSize {
+		return false
+	}
+	age := now.Sub(modTime)
+	if f.minAge > 0 && age < f.minAge {
+		return false
+	}
+	if f.maxAge > 0 && age > f.maxAge {
+		return false
+	}
+	for _, l := range f.lines {
+		if l.match(p) {
+			return l.include
+		}
+	}
+	return !f.hasInclude
+}
+
+// Signature identifies the filter's source text, referenced presets included; it changes
+// whenever the filter may match differently.
+func (f *FileFilter) Signature() string {
+	if f == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(f.src))
+	return hex.EncodeToString(sum[:])
+}
+
+// timed reports whether the filter depends on the current time (min_age / max_age), so files
+// it passed before may no longer pass.
+func (f *FileFilter) timed() bool {
+	return f != nil && (f.minAge > 0 || f.maxAge > 0)
+}
+
+// PathsOnly drops the size and age bounds. Bisync compares listings of both sides between runs,
+// and a file crossing a bound would otherwise look deleted.
+func (f *FileFilter) PathsOnly() *FileFilter {
+	if f == nil {
+		return nil
+	}
+	return &FileFilter{lines: f.lines, hasInclude: f.hasInclude}
+}
+
+// ValidateFilters checks the syntax of rule.filters. Preset references are resolved at scan time.
+func ValidateFilters(raw string) error {
+	return new(FileFilter).add(raw, nil, false)
+}
+
+// NewFileFilter compiles the rule's filters and ignore_extensions. presets may be nil when the
+// filters reference no preset.
+func NewFileFilter(rule Rule, presets map[string]ExtensionPreset) (*FileFilter, error) {
+	exts := ParseIgnoreExtensions(rule.IgnoreExtensions)
+	if len(exts) == 0 && strings.TrimSpace(rule.Filters) == "" {
+		return nil, nil
+	}
+	f := &FileFilter{}
+	f.src = rule.IgnoreExtensions + "\n"
+	for _, ext := range exts {
+		f.lines = append(f.lines, filterLine{suffix: ext})
+	}
+	if err := f.add(rule.Filters, presets, false); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// RuleFileFilter loads the presets the rule references and compiles its filter.
+func (s *Store) RuleFileFilter(ctx context.Context, rule Rule) (*FileFilter, error) {
+	var presets map[string]ExtensionPreset
+	if strings.Contains(rule.Filters, "preset:") {
+		list, err := s.ListExtensionPresets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		presets = map[string]ExtensionPreset{}
+		for _, p := range list {
+			presets[p.Name] = p
+		}
+	}
+	return NewFileFilter(rule, presets)
+}
+
+// dropFilteredFiles deletes not-yet-transferred rows of the rule that the filter now excludes.
+func dropFilteredFiles(ctx context.Context, tx *sql.Tx, ruleID string, filter *FileFilter) error {
+	rows, err := tx.QueryContext(ctx, `
+SELECT path, size, mod_time
+FROM files
+WHERE rule_id=? AND state IN ('new','stable','queued','failed','dead','missing')
+`, ruleID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var drop []string
+	for rows.Next() {
+		var p, mod string
+		var size int64
+		if err := rows.Scan(&p, &size, &mod); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		mt, _ := time.Parse(time.RFC3339, mod)
+		if !filter.Match(p, size, mt, now) {
+			drop = append(drop, p)
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, p := range drop {
+		if _, err := tx.ExecContext(ctx, `
+DELETE FROM files
+WHERE rule_id=? AND path=? AND state IN ('new','stable','queued','failed','dead','missing')
+`, ruleID, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add parses raw into f. With presets == nil, preset references are only checked for syntax.
+func (f *FileFilter) add(raw string, presets map[string]ExtensionPreset, inPreset bool) error {
+	if !inPreset {
+		f.src += raw + "\n"
+	}
+	for i, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := f.addLine(line, presets, inPreset); err != nil {
+			return fmt.Errorf("filters line %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (f *FileFilter) addLine(line string, presets map[string]ExtensionPreset, inPreset bool) error {
+	if name, ok := strings.CutPrefix(line, "preset:"); ok {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("preset name required")
+		}
+		if inPreset {
+			return fmt.Errorf("presets cannot reference other presets")
+		}
+		if presets == nil {
+			return nil
+		}
+		p, ok := presets[name]
+		if !ok {
+			return fmt.Errorf("unknown filter preset: %s", name)
+		}
+		f.src += "preset " + name + "\n" + p.Extensions + "\n" + p.Filters + "\n"
+		for _, ext := range ParseIgnoreExtensions(p.Extensions) {
+			f.lines = append(f.lines, filterLine{suffix: ext})
+		}
+		if err := f.add(p.Filters, presets, true); err != nil {
+			return fmt.Errorf("preset %s: %w", name, err)
+		}
+		return nil
+	}
+	if line[0] == '+' || line[0] == '-' {
+		include := line[0] == '+'
+		pat := strings.TrimSpace(line[1:])
+		if pat == "" {
+			return fmt.Errorf("pattern required: %q", line)
+		}
+		l := filterLine{include: include}
+		switch {
+		case strings.HasPrefix(pat, "re:"):
+			re, err := regexp.Compile(strings.TrimPrefix(pat, "re:"))
+			if err != nil {
+				return fmt.Errorf("invalid regex: %w", err)
+			}
+			l.re = re
+		case strings.HasPrefix(pat, "dir:"):
+			dir := strings.Trim(path.Clean("/"+strings.TrimSpace(strings.TrimPrefix(pat, "dir:"))), "/")
+			if dir == "" {
+				return fmt.Errorf("directory required: %q", line)
+			}
+			l.dir = dir
+		default:
+			re, err := globRegexp(pat)
+			if err != nil {
+				return err
+			}
+			l.re = re
+		}
+		f.lines = append(f.lines, l)
+		if include {
+			f.hasInclude = true
+		}
+		return nil
+	}
+	key, val, _ := strings.Cut(line, " ")
+	val = strings.TrimSpace(val)
+	var err error
+	switch key {
+	case "min_size":
+		f.minSize, err = parseFilterSize(val)
+	case "max_size":
+		f.maxSize, err = parseFilterSize(val)
+	case "min_age":
+		f.minAge, err = parseFilterAge(val)
+	case "max_age":
+		f.maxAge, err = parseFilterAge(val)
+	default:
+		return fmt.Errorf("unknown filter: %q", line)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// globRegexp converts an rclone-style glob into a regexp over the relative path.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	if strings.HasPrefix(glob, "/") {
+		b.WriteString("^")
+		glob = strings.TrimLeft(glob, "/")
+	} else {
+		b.WriteString("(^|/)")
+	}
+	inClass, inAlt := false, false
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case inClass:
+			b.WriteByte(c)
+			if c == ']' {
+				inClass = false
+			}
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			inClass = true
+			b.WriteByte(c)
+		case c == '{' && !inAlt:
+			inAlt = true
+			b.WriteString("(")
+		case c == '}' && inAlt:
+			inAlt = false
+			b.WriteString(")")
+		case c == ',' && inAlt:
+			b.WriteString("|")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if inClass || inAlt {
+		return nil, fmt.Errorf("unterminated pattern: %q", glob)
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func parseFilterSize(raw string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size: %q", raw)
+	}
+	return int64(f * float64(mult)), nil
+}
+
+func parseFilterAge(raw string) (time.Duration, error) {
+	s := strings.TrimSpace(raw)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			f, err := strconv.ParseFloat(n, 64)
+			if err != nil || f < 0 {
+				return 0, fmt.Errorf("invalid age: %q", raw)
+			}
+			return time.Duration(f * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age: %q", raw)
+	}
+	return d, nil
+}
@@ -4,7 +4,7 @@ import "strings"
 
 // ParseIgnoreExtensions parses rule.ignore_extensions into a list of normalized suffixes.
 // Supported inputs: ".png .jpg", "png,jpg", "*.png".
-// Unsupported glob patterns (containing wildcard chars) are ignored.
+// Unsupported glob patterns (containing wildcard chars) are ignored; rule.filters handles globs.
 func ParseIgnoreExtensions(raw string) []string {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
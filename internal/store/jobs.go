@@ -20,9 +20,35 @@ type Job struct {
 	AvgSpeed      float64
 	Error         string
 	LogPath       string
+	// DstRemote is set when the job wrote to a limit-group fallback instead of the rule's destination.
+	DstRemote     string
+	// ServiceAccount is the service-account file (base name) the job ran as, see LimitGroup.ServiceAccountDir.
+	ServiceAccount string
+	// VerifyStatus is "" (not verified), "passed", "failed" or "error".
+	VerifyStatus  string
+	VerifyPassed  int
+	VerifyFailed  int
+	VerifyError   string
 	SelectedFiles int
 }
 
+const jobColumns = `job_id, rule_id, transfer_mode, rc_port, started_at, ended_at, status, bytes_done, avg_speed, error, log_path, dst_remote,
+	verify_status, verify_passed, verify_failed, verify_error, service_account`
+
+func scanJobRow(row rowScanner) (Job, error) {
+	var j Job
+	var started, ended int64
+	if err := row.Scan(&j.JobID, &j.RuleID, &j.TransferMode, &j.RcPort, &started, &ended, &j.Status, &j.BytesDone, &j.AvgSpeed, &j.Error, &j.LogPath, &j.DstRemote,
+		&j.VerifyStatus, &j.VerifyPassed, &j.VerifyFailed, &j.VerifyError, &j.ServiceAccount); err != nil {
+		return Job{}, err
+	}
+	j.StartedAt = time.Unix(started, 0)
+	if ended != 0 {
+		j.EndedAt = time.Unix(ended, 0)
+	}
+	return j, nil
+}
+
 type JobFilter struct {
 	RuleID       string
 	Status       string
@@ -77,7 +103,7 @@ func (s *Store) ListJobsPage(ctx context.Context, limit, offset int) ([]Job, err
 		offset = 0
 	}
 	rows, err := s.db.QueryContext(ctx, `
-SELECT job_id, rule_id, transfer_mode, rc_port, started_at, ended_at, status, bytes_done, avg_speed, error, log_path
+SELECT `+jobColumns+`
 FROM jobs
 ORDER BY started_at DESC
 LIMIT ? OFFSET ?
@@ -88,15 +114,10 @@ LIMIT ? OFFSET ?
 	defer rows.Close()
 	var out []Job
 	for rows.Next() {
-		var j Job
-		var started, ended int64
-		if err := rows.Scan(&j.JobID, &j.RuleID, &j.TransferMode, &j.RcPort, &started, &ended, &j.Status, &j.BytesDone, &j.AvgSpeed, &j.Error, &j.LogPath); err != nil {
+		j, err := scanJobRow(rows)
+		if err != nil {
 			return nil, err
 		}
-		j.StartedAt = time.Unix(started, 0)
-		if ended != 0 {
-			j.EndedAt = time.Unix(ended, 0)
-		}
 		out = append(out, j)
 	}
 	return out, rows.Err()
@@ -117,7 +138,7 @@ func (s *Store) ListJobsPageFiltered(ctx context.Context, limit, offset int, f J
 	}
 	where, args := buildJobsWhere(f)
 	q := `
-SELECT job_id, rule_id, transfer_mode, rc_port, started_at, ended_at, status, bytes_done, avg_speed, error, log_path
+SELECT `+jobColumns+`
 FROM jobs
 ` + where + `
 ORDER BY started_at DESC
@@ -132,15 +153,10 @@ LIMIT ? OFFSET ?
 	defer rows.Close()
 	var out []Job
 	for rows.Next() {
-		var j Job
-		var started, ended int64
-		if err := rows.Scan(&j.JobID, &j.RuleID, &j.TransferMode, &j.RcPort, &started, &ended, &j.Status, &j.BytesDone, &j.AvgSpeed, &j.Error, &j.LogPath); err != nil {
+		j, err := scanJobRow(rows)
+		if err != nil {
 			return nil, err
 		}
-		j.StartedAt = time.Unix(started, 0)
-		if ended != 0 {
-			j.EndedAt = time.Unix(ended, 0)
-		}
 		out = append(out, j)
 	}
 	return out, rows.Err()
@@ -179,23 +195,17 @@ func buildJobsWhere(f JobFilter) (string, []any) {
 }
 
 func (s *Store) GetJob(ctx context.Context, id string) (Job, bool, error) {
-	var j Job
-	var started, ended int64
-	err := s.db.QueryRowContext(ctx, `
-SELECT job_id, rule_id, transfer_mode, rc_port, started_at, ended_at, status, bytes_done, avg_speed, error, log_path
+	j, err := scanJobRow(s.db.QueryRowContext(ctx, `
+SELECT `+jobColumns+`
 FROM jobs
 WHERE job_id=?
-`, id).Scan(&j.JobID, &j.RuleID, &j.TransferMode, &j.RcPort, &started, &ended, &j.Status, &j.BytesDone, &j.AvgSpeed, &j.Error, &j.LogPath)
+`, id))
 	if errors.Is(err, sql.ErrNoRows) {
 		return Job{}, false, nil
 	}
 	if err != nil {
 		return Job{}, false, err
 	}
-	j.StartedAt = time.Unix(started, 0)
-	if ended != 0 {
-		j.EndedAt = time.Unix(ended, 0)
-	}
 	return j, true, nil
 }
 
@@ -321,6 +331,7 @@ SELECT COALESCE(SUM(j.bytes_done), 0)
 FROM jobs j
 JOIN rules r ON j.rule_id = r.id
 WHERE r.limit_group = ?
+  AND j.dst_remote = ''
   AND ((j.status = 'running') OR (j.ended_at >= ? AND j.status != 'running'))
 `
 	var n int64
@@ -328,7 +339,8 @@ WHERE r.limit_group = ?
 	return n, err
 }
 
-// GroupBudgetSince is the group-level variant of RuleBudgetSince.
+// GroupBudgetSince is the group-level variant of RuleBudgetSince. It covers the rules' own
+// destinations only; traffic spilled to fallbacks is counted by GroupFallbackBudgetSince.
 func (s *Store) GroupBudgetSince(ctx context.Context, group string, since time.Time) (int64, error) {
 	if group == "" {
 		return 0, nil
@@ -339,6 +351,7 @@ SELECT COALESCE(SUM(j.bytes_done), 0)
 FROM jobs j
 JOIN rules r ON j.rule_id = r.id
 WHERE r.limit_group = ?
+  AND j.dst_remote = ''
   AND j.ended_at >= ?
   AND j.status != 'running'
 `, group, since.Unix()).Scan(&ended); err != nil {
@@ -352,12 +365,76 @@ FROM files f
 JOIN rules r ON f.rule_id = r.id
 WHERE r.limit_group = ?
   AND f.state = 'transferring'
+  AND f.dst_remote IN ('', r.dst_remote)
+`, group).Scan(&inflight); err != nil {
+		return 0, err
+	}
+	return ended + inflight, nil
+}
+
+// GroupFileBudgetSince is GroupBudgetSince counting files instead of bytes: files completed by
+// jobs that ended in the window plus files currently transferring to the rules' own destinations.
+func (s *Store) GroupFileBudgetSince(ctx context.Context, group string, since time.Time) (int64, error) {
+	if group == "" {
+		return 0, nil
+	}
+	var ended int64
+	if err := s.db.QueryRowContext(ctx, `
+SELECT COALESCE(SUM(j.files_done), 0)
+FROM jobs j
+JOIN rules r ON j.rule_id = r.id
+WHERE r.limit_group = ?
+  AND j.dst_remote = ''
+  AND j.ended_at >= ?
+  AND j.status != 'running'
+`, group, since.Unix()).Scan(&ended); err != nil {
+		return 0, err
+	}
+
+	var inflight int64
+	if err := s.db.QueryRowContext(ctx, `
+SELECT COUNT(*)
+FROM files f
+JOIN rules r ON f.rule_id = r.id
+WHERE r.limit_group = ?
+  AND f.state = 'transferring'
+  AND f.dst_remote IN ('', r.dst_remote)
 `, group).Scan(&inflight); err != nil {
 		return 0, err
 	}
 	return ended + inflight, nil
 }
 
+// GroupFallbackBudgetSince is GroupBudgetSince for traffic the group spilled to dstRemote.
+func (s *Store) GroupFallbackBudgetSince(ctx context.Context, group, dstRemote string, since time.Time) (int64, error) {
+	var ended int64
+	if err := s.db.QueryRowContext(ctx, `
+SELECT COALESCE(SUM(j.bytes_done), 0)
+FROM jobs j
+JOIN rules r ON j.rule_id = r.id
+WHERE r.limit_group = ?
+  AND j.dst_remote = ?
+  AND j.ended_at >= ?
+  AND j.status != 'running'
+`, group, dstRemote, since.Unix()).Scan(&ended); err != nil {
+		return 0, err
+	}
+
+	var inflight int64
+	if err := s.db.QueryRowContext(ctx, `
+SELECT COALESCE(SUM(f.size), 0)
+FROM files f
+JOIN rules r ON f.rule_id = r.id
+WHERE r.limit_group = ?
+  AND f.state = 'transferring'
+  AND f.dst_remote = ?
+  AND f.dst_remote != r.dst_remote
+`, group, dstRemote).Scan(&inflight); err != nil {
+		return 0, err
+	}
+	return ended + inflight, nil
+}
+
 func (s *Store) CountRunningJobsAll(ctx context.Context) (int, error) {
 	var n int
 	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM jobs WHERE status='running'`).Scan(&n)
@@ -9,7 +9,7 @@ import (
 )
 
 func (s *Store) ListLimitGroups(ctx context.Context) ([]LimitGroup, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT name, daily_limit_bytes, updated_at FROM limit_groups ORDER BY name`)
+	rows, err := s.db.QueryContext(ctx, `SELECT name, daily_limit_bytes, daily_limit_files, weekly_limit_bytes, monthly_limit_bytes, sa_dir, sa_daily_limit_bytes, reset_mode, reset_time, timezone, updated_at FROM limit_groups ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
@@ -18,19 +18,31 @@ func (s *Store) ListLimitGroups(ctx context.Context) ([]LimitGroup, error) {
 	for rows.Next() {
 		var g LimitGroup
 		var updated int64
-		if err := rows.Scan(&g.Name, &g.DailyLimitBytes, &updated); err != nil {
+		if err := rows.Scan(&g.Name, &g.DailyLimitBytes, &g.DailyLimitFiles, &g.WeeklyLimitBytes, &g.MonthlyLimitBytes, &g.ServiceAccountDir, &g.ServiceAccountLimitBytes, &g.ResetMode, &g.ResetTime, &g.Timezone, &updated); err != nil {
 			return nil, err
 		}
 		g.UpdatedAt = time.Unix(updated, 0)
 		out = append(out, g)
 	}
-	return out, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	_ = rows.Close()
+	for i := range out {
+		fbs, err := s.ListLimitGroupFallbacks(ctx, out[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		out[i].Fallbacks = fbs
+	}
+	return out, nil
 }
 
 func (s *Store) GetLimitGroup(ctx context.Context, name string) (LimitGroup, bool, error) {
 	var g LimitGroup
 	var updated int64
-	err := s.db.QueryRowContext(ctx, `SELECT name, daily_limit_bytes, updated_at FROM limit_groups WHERE name=?`, name).Scan(&g.Name, &g.DailyLimitBytes, &updated)
+	err := s.db.QueryRowContext(ctx, `SELECT name, daily_limit_bytes, daily_limit_files, weekly_limit_bytes, monthly_limit_bytes, sa_dir, sa_daily_limit_bytes, reset_mode, reset_time, timezone, updated_at FROM limit_groups WHERE name=?`, name).Scan(
+		&g.Name, &g.DailyLimitBytes, &g.DailyLimitFiles, &g.WeeklyLimitBytes, &g.MonthlyLimitBytes, &g.ServiceAccountDir, &g.ServiceAccountLimitBytes, &g.ResetMode, &g.ResetTime, &g.Timezone, &updated)
 	if errors.Is(err, sql.ErrNoRows) {
 		return LimitGroup{}, false, nil
 	}
@@ -38,24 +50,82 @@ func (s *Store) GetLimitGroup(ctx context.Context, name string) (LimitGroup, boo
 		return LimitGroup{}, false, err
 	}
 	g.UpdatedAt = time.Unix(updated, 0)
+	g.Fallbacks, err = s.ListLimitGroupFallbacks(ctx, name)
+	if err != nil {
+		return LimitGroup{}, false, err
+	}
 	return g, true, nil
 }
 
-func (s *Store) UpsertLimitGroup(ctx context.Context, g LimitGroup) error {
-	g.Name = strings.TrimSpace(g.Name)
-	if g.Name == "" {
-		return errors.New("group name required")
+func (s *Store) ListLimitGroupFallbacks(ctx context.Context, group string) ([]LimitGroupFallback, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT dst_remote, daily_limit_bytes
+FROM limit_group_fallbacks
+WHERE group_name=?
+ORDER BY position
+`, group)
+	if err != nil {
+		return nil, err
 	}
-	if g.DailyLimitBytes < 0 {
-		g.DailyLimitBytes = 0
+	defer rows.Close()
+	var out []LimitGroupFallback
+	for rows.Next() {
+		var fb LimitGroupFallback
+		if err := rows.Scan(&fb.DstRemote, &fb.DailyLimitBytes); err != nil {
+			return nil, err
+		}
+		out = append(out, fb)
+	}
+	return out, rows.Err()
+}
+
+// SetLimitGroupFallbacks replaces the ordered fallback list of a group.
+func (s *Store) SetLimitGroupFallbacks(ctx context.Context, group string, fbs []LimitGroupFallback) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM limit_group_fallbacks WHERE group_name=?`, group); err != nil {
+		return err
+	}
+	for i, fb := range fbs {
+		fb.DstRemote = strings.TrimSpace(fb.DstRemote)
+		if fb.DstRemote == "" {
+			return errors.New("fallback dst_remote required")
+		}
+		if fb.DailyLimitBytes < 0 {
+			fb.DailyLimitBytes = 0
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO limit_group_fallbacks(group_name, position, dst_remote, daily_limit_bytes)
+VALUES(?, ?, ?, ?)
+`, group, i, fb.DstRemote, fb.DailyLimitBytes); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) UpsertLimitGroup(ctx context.Context, g LimitGroup) error {
+	if err := g.Normalize(); err != nil {
+		return err
 	}
 	_, err := s.db.ExecContext(ctx, `
-INSERT INTO limit_groups(name, daily_limit_bytes, updated_at)
-VALUES(?, ?, ?)
+INSERT INTO limit_groups(name, daily_limit_bytes, daily_limit_files, weekly_limit_bytes, monthly_limit_bytes, sa_dir, sa_daily_limit_bytes, reset_mode, reset_time, timezone, updated_at)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 ON CONFLICT(name) DO UPDATE SET
   daily_limit_bytes=excluded.daily_limit_bytes,
+  daily_limit_files=excluded.daily_limit_files,
+  weekly_limit_bytes=excluded.weekly_limit_bytes,
+  monthly_limit_bytes=excluded.monthly_limit_bytes,
+  sa_dir=excluded.sa_dir,
+  sa_daily_limit_bytes=excluded.sa_daily_limit_bytes,
+  reset_mode=excluded.reset_mode,
+  reset_time=excluded.reset_time,
+  timezone=excluded.timezone,
   updated_at=excluded.updated_at
-`, g.Name, g.DailyLimitBytes, nowUnix())
+`, g.Name, g.DailyLimitBytes, g.DailyLimitFiles, g.WeeklyLimitBytes, g.MonthlyLimitBytes, g.ServiceAccountDir, g.ServiceAccountLimitBytes, g.ResetMode, g.ResetTime, g.Timezone, nowUnix())
 	return err
 }
 
@@ -72,14 +142,14 @@ func (s *Store) SetRulesForLimitGroup(ctx context.Context, groupName string, rul
 	defer func() { _ = tx.Rollback() }()
 
 	// 1. Remove this group from all rules that currently have it (reset to empty)
-	if _, err := tx.ExecContext(ctx, `UPDATE rules SET limit_group='' WHERE limit_group=?`, groupName); err != nil {
+	if _, err := tx.ExecContext(ctx, `UPDATE rules SET limit_group='' WHERE limit_group=? AND parent_id=''`, groupName); err != nil {
 		return err
 	}
 
 	// 2. Set this group for the provided rule IDs
 	if len(ruleIDs) > 0 {
 		// Prepare a query with placeholders
-		query := `UPDATE rules SET limit_group=? WHERE id IN (?` + strings.Repeat(",?", len(ruleIDs)-1) + `)`
+		query := `UPDATE rules SET limit_group=? WHERE parent_id='' AND id IN (?` + strings.Repeat(",?", len(ruleIDs)-1) + `)`
 		args := make([]any, len(ruleIDs)+1)
 		args[0] = groupName
 		for i, id := range ruleIDs {
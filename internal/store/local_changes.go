@@ -0,0 +1,46 @@
+package store
+
+import "context"
+
+// ApplyLocalChanges applies what a file system watcher saw below a local source to the rule and
+// its fan-out replicas (rules[0] and the rest), without a scan. Changed files go through the
+// same states as listed ones (see UpsertScanEntries); waiting files at or below a removed path
+// are marked missing right away. Transferred files that were removed are left to the next full
+// scan, which counts them towards MissingGraceScans.
+func (s *Store) ApplyLocalChanges(ctx context.Context, rules []Rule, changed []ScanEntry, removed []string) error {
+	targets := make([]scanTarget, 0, len(rules))
+	for _, r := range rules {
+		t, err := s.newScanTarget(ctx, r)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, t)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, t := range targets {
+		if len(changed) > 0 {
+			if err := t.upsert(ctx, tx, changed); err != nil {
+				return err
+			}
+			if err := t.dropSmall(ctx, tx); err != nil {
+				return err
+			}
+		}
+		for _, p := range removed {
+			prefix := p + "/"
+			if _, err := tx.ExecContext(ctx, `
+UPDATE files
+SET state='missing'
+WHERE rule_id=? AND (path=? OR substr(path, 1, length(?))=?) AND upstream_rule_id=''
+  AND state IN ('new','stable','queued','failed','dead')
+`, t.rule.ID, p, prefix, prefix); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
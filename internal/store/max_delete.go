@@ -0,0 +1,45 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseMaxDelete parses rule.max_delete, the per-job cap on destination deletions for sync rules.
+// Supported inputs: "" (no cap), "100" (absolute count), "10%" (percentage of tracked files).
+func ParseMaxDelete(raw string) (count int, percent float64, err error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return -1, -1, nil
+	}
+	if strings.HasSuffix(raw, "%") {
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(raw, "%")), 64)
+		if err != nil || math.IsNaN(f) || f < 0 || f > 100 {
+			return 0, 0, fmt.Errorf("invalid max_delete: %q", raw)
+		}
+		return -1, f, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("invalid max_delete: %q", raw)
+	}
+	return n, -1, nil
+}
+
+// MaxDeleteLimit resolves max_delete against the number of tracked files.
+// It returns -1 when deletions are not capped.
+func (r Rule) MaxDeleteLimit(tracked int) int {
+	count, percent, err := ParseMaxDelete(r.MaxDelete)
+	if err != nil {
+		return 0
+	}
+	if count >= 0 {
+		return count
+	}
+	if percent >= 0 {
+		return int(math.Floor(float64(tracked) * percent / 100))
+	}
+	return -1
+}
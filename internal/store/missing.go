@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// MarkMissingFiles marks the rule's waiting files that a complete scan started at scanStart
+// did not list as 'missing', which takes them out of the queue, and counts the scans each has
+// been missed by. A file that shows up again is picked up by UpsertScanEntries as usual. Files
+// fed by an upstream rule are never listed by the scan and are left alone.
+func (s *Store) MarkMissingFiles(ctx context.Context, rule Rule, scanStart time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+UPDATE files
+SET state='missing', missed_scans=missed_scans+1
+WHERE rule_id=? AND last_seen<? AND upstream_rule_id=''
+  AND state IN ('new','stable','queued','failed','dead','missing')
+`, rule.ID, scanStart.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PurgeMissingFiles deletes the rows of files missing for at least rule.MissingGraceScans scans.
+func (s *Store) PurgeMissingFiles(ctx context.Context, rule Rule) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+DELETE FROM files WHERE rule_id=? AND state='missing' AND missed_scans>=?
+`, rule.ID, rule.MissingGraceScans)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// MissingDeletionCandidates returns the files missing for at least rule.MissingGraceScans scans,
+// for a sync rule to delete at the destination along with its other deletions. Only files this
+// rule has transferred before count: the destination copy of a file that never got there, or
+// that reconcile only matched by size, is not the rule's to delete.
+func (s *Store) MissingDeletionCandidates(ctx context.Context, rule Rule) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT path FROM files
+WHERE rule_id=? AND state='missing' AND missed_scans>=? AND done_at>0 AND done_unconfirmed=0
+ORDER BY path
+`, rule.ID, rule.MissingGraceScans)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
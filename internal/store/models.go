@@ -12,9 +12,32 @@ import (
 type LimitGroup struct {
 	Name            string
 	DailyLimitBytes int64
+	// DailyLimitFiles caps how many files the group transfers per quota day (0 = unlimited).
+	DailyLimitFiles int64
+	// WeeklyLimitBytes and MonthlyLimitBytes are extra caps over a week / month (0 = none).
+	WeeklyLimitBytes  int64
+	MonthlyLimitBytes int64
+	// ServiceAccountDir holds Google Drive service-account JSON files; each job to the group's own
+	// destinations then runs as the least used account with quota left. ServiceAccountLimitBytes is
+	// each account's quota per quota day (0 = only stop on provider quota errors).
+	ServiceAccountDir        string
+	ServiceAccountLimitBytes int64
+	// ResetMode is "rolling" (the last 24h / 7d / 30d) or "fixed": quotas start over every day at
+	// ResetTime ("HH:MM") in Timezone (IANA name, "" = daemon local), weeks on Monday, months on the 1st.
+	ResetMode       string
+	ResetTime       string
+	Timezone        string
+	// Fallbacks are tried in order once the group's own quota is used up.
+	Fallbacks       []LimitGroupFallback
 	UpdatedAt       time.Time
 }
 
+// LimitGroupFallback is a spill-over destination remote with its own daily quota (0 = unlimited).
+type LimitGroupFallback struct {
+	DstRemote       string
+	DailyLimitBytes int64
+}
+
 type Remote struct {
 	Name       string
 	Type       string
@@ -23,12 +46,52 @@ type Remote struct {
 	ConfigJSON string
 }
 
+// ExtensionPreset is a named, reusable filter set. Rules reference it with a "preset:<name>"
+// filters line; its extensions are excluded and its filters spliced in.
 type ExtensionPreset struct {
 	Name       string
 	Extensions string
+	Filters    string
 	UpdatedAt  time.Time
 }
 
+func (g *LimitGroup) Normalize() error {
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" {
+		return errors.New("group name required")
+	}
+	for _, n := range []*int64{&g.DailyLimitBytes, &g.DailyLimitFiles, &g.WeeklyLimitBytes, &g.MonthlyLimitBytes, &g.ServiceAccountLimitBytes} {
+		if *n < 0 {
+			*n = 0
+		}
+	}
+	g.ServiceAccountDir = strings.TrimSpace(g.ServiceAccountDir)
+	g.ResetMode = strings.TrimSpace(strings.ToLower(g.ResetMode))
+	if g.ResetMode == "" {
+		g.ResetMode = "rolling"
+	}
+	g.ResetTime = strings.TrimSpace(g.ResetTime)
+	g.Timezone = strings.TrimSpace(g.Timezone)
+	switch g.ResetMode {
+	case "rolling":
+	case "fixed":
+		if g.ResetTime == "" {
+			g.ResetTime = "00:00"
+		}
+		if _, err := parseClock(g.ResetTime); err != nil {
+			return fmt.Errorf("reset_time: %w", err)
+		}
+		if g.Timezone != "" {
+			if _, err := time.LoadLocation(g.Timezone); err != nil {
+				return fmt.Errorf("invalid timezone: %q", g.Timezone)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid reset_mode: %q", g.ResetMode)
+	}
+	return nil
+}
+
 func (r *Remote) Normalize() error {
 	r.Name = strings.TrimSpace(r.Name)
 	r.Type = strings.TrimSpace(r.Type)
@@ -66,6 +129,10 @@ func (r *Remote) UnmarshalConfig() error {
 
 type Rule struct {
 	ID              string
+	// ParentID is set on the hidden per-destination replicas of a fan-out rule.
+	ParentID        string
+	// UpstreamRule names the rule whose completed files this rule picks up directly (pipelines).
+	UpstreamRule    string
 	LimitGroup      string
 	SrcKind         string
 	SrcRemote       string
@@ -75,8 +142,19 @@ type Rule struct {
 	DstRemote       string
 	DstPath         string
 	TransferMode    string
+	MaxDelete       string
+	ConflictPolicy  string
+	VerifyMode      string
 	RcloneExtraArgs string
 	IgnoreExtensions string
+	Filters          string
+	// JobSchedule and ScanSchedule limit when jobs may start and when scans run (see ParseSchedule); empty = always.
+	JobSchedule      string
+	ScanSchedule     string
+	// WindowPolicy decides what happens to running jobs when the job window closes: finish, terminate or throttle
+	// (lower the job's bandwidth to WindowBwlimit until the window opens again).
+	WindowPolicy     string
+	WindowBwlimit    string
 	Bwlimit         string
 	DailyLimitBytes int64
 	MinFileSizeBytes int64
@@ -85,6 +163,31 @@ type Rule struct {
 	ScanIntervalSec int
 	StableSeconds   int
 	BatchSize       int
+	// BatchMaxBytes caps the total size of one job's batch (0 = count only).
+	BatchMaxBytes   int64
+	// QueueOrder picks which stable/queued files go first (see queueOrderBy); PriorityRules raise or lower files by path pattern.
+	QueueOrder      string
+	PriorityRules   string
+	// MissingAction decides what happens to files that vanished from the source once they were
+	// missed by MissingGraceScans scans in a row: keep them as missing, purge the rows, or
+	// (sync rules) propagate the deletion to the destination.
+	MissingAction     string
+	MissingGraceScans int
+	// Copy rules can clean up the source once files are safely at the destination: after
+	// SourceDeleteAfterDays days, or (local sources) as soon as the source disk is fuller than
+	// SourceDeleteWatermark percent. SourceTrashDir moves local files aside instead of deleting them.
+	SourceDeleteAfterDays int
+	SourceDeleteWatermark int
+	SourceTrashDir        string
+	// SeedFromDest reconciles the rule with its destination after the first scan, marking
+	// files the destination already has as done instead of transferring them.
+	SeedFromDest bool
+	// ScanStrategy is how scans list the source: full (a recursive listing every time), recent
+	// (only files modified since the last scan) or dirs (descend only into directories whose
+	// modification time changed). Incremental strategies still list everything every
+	// FullScanIntervalSec, since they miss files moved in with an old modification time.
+	ScanStrategy        string
+	FullScanIntervalSec int
 	Enabled         bool
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
@@ -108,13 +211,107 @@ func (r *Rule) Normalize() error {
 	r.TransferMode = strings.TrimSpace(strings.ToLower(r.TransferMode))
 	r.RcloneExtraArgs = strings.TrimSpace(r.RcloneExtraArgs)
 	r.IgnoreExtensions = strings.TrimSpace(r.IgnoreExtensions)
+	r.Filters = strings.TrimSpace(r.Filters)
+	if err := ValidateFilters(r.Filters); err != nil {
+		return err
+	}
+	if r.Filters != "" && r.IsManual {
+		// Filters apply to scan results, and manual runs hand the whole source to rclone.
+		return errors.New("filters are not supported for manual runs; use rclone filter flags in rclone_extra_args")
+	}
 	if r.TransferMode == "" {
 		r.TransferMode = "copy"
 	}
-	if r.TransferMode != "copy" && r.TransferMode != "move" {
+	switch r.TransferMode {
+	case "copy", "move", "sync", "bisync":
+	default:
 		return fmt.Errorf("invalid transfer_mode: %q", r.TransferMode)
 	}
+	r.ConflictPolicy = strings.TrimSpace(strings.ToLower(r.ConflictPolicy))
+	if r.ConflictPolicy == "" {
+		r.ConflictPolicy = "newer"
+	}
+	switch r.ConflictPolicy {
+	case "newer", "keep_both", "prefer_src", "prefer_dst":
+	default:
+		return fmt.Errorf("invalid conflict_policy: %q", r.ConflictPolicy)
+	}
+	r.VerifyMode = strings.TrimSpace(strings.ToLower(r.VerifyMode))
+	switch r.VerifyMode {
+	case "", "size", "checksum":
+	default:
+		return fmt.Errorf("invalid verify_mode: %q", r.VerifyMode)
+	}
+	if r.VerifyMode != "" && r.TransferMode == "bisync" {
+		return errors.New("verify_mode is not supported for bisync rules")
+	}
+	if r.VerifyMode == "checksum" && r.TransferMode == "move" {
+		// The source copy is gone after a move; only the destination size can be checked.
+		return errors.New("verify_mode=checksum needs the source; use size for move rules")
+	}
+	if err := ValidateDstPath(r.DstPath); err != nil {
+		return err
+	}
+	if HasDstPlaceholders(r.DstPath) {
+		if r.IsManual || (r.TransferMode != "copy" && r.TransferMode != "move") {
+			return errors.New("dst_path placeholders are only supported for copy/move rules")
+		}
+	}
+	r.MaxDelete = strings.TrimSpace(r.MaxDelete)
+	if _, _, err := ParseMaxDelete(r.MaxDelete); err != nil {
+		return err
+	}
 	r.Bwlimit = strings.TrimSpace(r.Bwlimit)
+	if _, err := ParseBwlimit(r.Bwlimit); err != nil {
+		return err
+	}
+	r.JobSchedule = strings.TrimSpace(r.JobSchedule)
+	if _, err := ParseSchedule(r.JobSchedule); err != nil {
+		return fmt.Errorf("job_schedule: %w", err)
+	}
+	r.ScanSchedule = strings.TrimSpace(r.ScanSchedule)
+	if _, err := ParseSchedule(r.ScanSchedule); err != nil {
+		return fmt.Errorf("scan_schedule: %w", err)
+	}
+	r.WindowPolicy = strings.TrimSpace(strings.ToLower(r.WindowPolicy))
+	if r.WindowPolicy == "" {
+		r.WindowPolicy = "finish"
+	}
+	switch r.WindowPolicy {
+	case "finish", "terminate", "throttle":
+	default:
+		return fmt.Errorf("invalid window_policy: %q", r.WindowPolicy)
+	}
+	r.MissingAction = strings.TrimSpace(strings.ToLower(r.MissingAction))
+	if r.MissingAction == "" {
+		r.MissingAction = "keep"
+	}
+	switch r.MissingAction {
+	case "keep", "purge", "propagate":
+	default:
+		return fmt.Errorf("invalid missing_action: %q", r.MissingAction)
+	}
+	if r.MissingAction == "propagate" && r.TransferMode != "sync" {
+		return errors.New("missing_action=propagate is only supported for sync rules")
+	}
+	if r.MissingGraceScans <= 0 {
+		r.MissingGraceScans = 2
+	}
+	if err := r.normalizeSourceCleanup(); err != nil {
+		return err
+	}
+	if err := r.normalizeSeedFromDest(); err != nil {
+		return err
+	}
+	r.WindowBwlimit = strings.TrimSpace(r.WindowBwlimit)
+	if r.WindowPolicy == "throttle" && r.WindowBwlimit == "" {
+		return errors.New("window_policy=throttle needs window_bwlimit")
+	}
+	if r.WindowBwlimit != "" {
+		if err := validateBwlimitRate(r.WindowBwlimit); err != nil {
+			return fmt.Errorf("window_bwlimit: %w", err)
+		}
+	}
 	if r.MinFileSizeBytes < 0 {
 		r.MinFileSizeBytes = 0
 	}
@@ -124,6 +321,17 @@ func (r *Rule) Normalize() error {
 	if r.ID == "" {
 		return errors.New("rule id required")
 	}
+	r.ParentID = strings.TrimSpace(r.ParentID)
+	r.UpstreamRule = strings.TrimSpace(r.UpstreamRule)
+	if r.UpstreamRule != "" && (r.UpstreamRule == r.ID || r.UpstreamRule == r.ParentID) {
+		return errors.New("a rule cannot be its own upstream")
+	}
+	if r.UpstreamRule != "" && r.IsManual {
+		return errors.New("manual runs cannot have an upstream rule")
+	}
+	if r.ParentID == "" && strings.Contains(r.ID, "@") {
+		return errors.New("rule id must not contain '@'")
+	}
 	if r.SrcKind == "remote" {
 		if r.SrcRemote == "" {
 			return errors.New("src_remote required for src_kind=remote")
@@ -153,9 +361,42 @@ func (r *Rule) Normalize() error {
 	if r.StableSeconds < 0 {
 		r.StableSeconds = 60
 	}
+	r.ScanStrategy = strings.TrimSpace(strings.ToLower(r.ScanStrategy))
+	if r.ScanStrategy == "" {
+		r.ScanStrategy = "full"
+	}
+	switch r.ScanStrategy {
+	case "full", "recent", "dirs":
+	default:
+		return fmt.Errorf("invalid scan_strategy: %q", r.ScanStrategy)
+	}
+	if r.ScanStrategy == "full" {
+		r.FullScanIntervalSec = 0
+	} else {
+		if r.TransferMode == "bisync" {
+			return errors.New("bisync rules only support scan_strategy=full")
+		}
+		if r.FullScanIntervalSec <= 0 {
+			r.FullScanIntervalSec = 86400
+		}
+		if r.FullScanIntervalSec < r.ScanIntervalSec {
+			r.FullScanIntervalSec = r.ScanIntervalSec
+		}
+	}
 	if r.BatchSize <= 0 {
 		r.BatchSize = 100
 	}
+	if r.BatchMaxBytes < 0 {
+		r.BatchMaxBytes = 0
+	}
+	r.QueueOrder = strings.TrimSpace(strings.ToLower(r.QueueOrder))
+	if !validQueueOrder(r.QueueOrder) {
+		return fmt.Errorf("invalid queue_order: %q", r.QueueOrder)
+	}
+	r.PriorityRules = strings.TrimSpace(r.PriorityRules)
+	if _, err := ParsePriorityRules(r.PriorityRules); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -0,0 +1,268 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// A rule may name an upstream rule. When a file of the upstream reaches done, it is inserted
+// into the downstream rule as stable, with its path mapped from the upstream destination to
+// the downstream source, so the downstream doesn't have to wait for its own scan to find it.
+// files.upstream_rule_id/upstream_path record where each fed file came from.
+
+// maxPipelineDepth bounds the upstream walk (cycle check and lineage).
+const maxPipelineDepth = 16
+
+// checkUpstream rejects unknown upstream rules and pipelines that loop back to r.
+func (s *Store) checkUpstream(ctx context.Context, r Rule) error {
+	up := strings.TrimSpace(r.UpstreamRule)
+	id := strings.TrimSpace(r.ID)
+	for depth := 0; up != ""; depth++ {
+		if up == id || depth >= maxPipelineDepth {
+			return fmt.Errorf("upstream_rule %s would create a cycle", r.UpstreamRule)
+		}
+		u, ok, err := s.GetRule(ctx, up)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if depth == 0 {
+				return fmt.Errorf("upstream rule not found: %s", up)
+			}
+			return nil
+		}
+		up = u.UpstreamRule
+	}
+	return nil
+}
+
+// downstreamPath maps a file written by an upstream job (remote:dstDir/rel) into the source of down.
+func downstreamPath(down Rule, dstRemote, dstDir, rel string) (string, bool) {
+	if down.SrcKind != "remote" || down.SrcRemote != dstRemote {
+		return "", false
+	}
+	full := cleanRemotePath(path.Join(dstDir, rel))
+	if down.SrcPath == "/" {
+		return strings.TrimPrefix(full, "/"), true
+	}
+	return strings.CutPrefix(full, down.SrcPath+"/")
+}
+
+// FeedDownstream hands the files jobID completed for upstream to every rule (and replica) that
+// names it as upstream_rule. It returns the number of files inserted or refreshed.
+func (s *Store) FeedDownstream(ctx context.Context, upstream Rule, jobID string) (int, error) {
+	upID := upstream.ID
+	if upstream.ParentID != "" {
+		upID = upstream.ParentID
+	}
+	downs, err := s.listDownstreamRules(ctx, upID)
+	if err != nil || len(downs) == 0 {
+		return 0, err
+	}
+	filters := make([]*FileFilter, len(downs))
+	priorities := make([]PriorityRules, len(downs))
+	for i, d := range downs {
+		if filters[i], err = s.RuleFileFilter(ctx, d); err != nil {
+			return 0, fmt.Errorf("rule %s: %w", d.ID, err)
+		}
+		if priorities[i], err = ParsePriorityRules(d.PriorityRules); err != nil {
+			return 0, fmt.Errorf("rule %s: %w", d.ID, err)
+		}
+	}
+
+	type doneFile struct {
+		path, modTime, dstRemote, dstPath string
+		size                              int64
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT path, size, mod_time, dst_remote, dst_path
+FROM files
+WHERE job_id=? AND state IN ('done','verified')
+`, jobID)
+	if err != nil {
+		return 0, err
+	}
+	var done []doneFile
+	for rows.Next() {
+		var f doneFile
+		if err := rows.Scan(&f.path, &f.size, &f.modTime, &f.dstRemote, &f.dstPath); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		if f.dstRemote == "" {
+			f.dstRemote = upstream.DstRemote
+		}
+		if f.dstPath == "" {
+			f.dstPath = upstream.DstPath
+		}
+		done = append(done, f)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if len(done) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO files(rule_id, path, size, mod_time, state, last_seen, seen_size, seen_mod_time, job_id, fail_count, last_error, upstream_rule_id, upstream_path, priority, first_seen)
+VALUES(?, ?, ?, ?, 'stable', ?, 0, '', NULL, 0, '', ?, ?, ?, ?)
+ON CONFLICT(rule_id, path) DO UPDATE SET
+  seen_size=files.size,
+  seen_mod_time=files.mod_time,
+  size=excluded.size,
+  mod_time=excluded.mod_time,
+  last_seen=excluded.last_seen,
+  priority=excluded.priority,
+  upstream_rule_id=excluded.upstream_rule_id,
+  upstream_path=excluded.upstream_path,
+  state=CASE
+    WHEN files.state IN ('transferring','queued') THEN files.state
+    WHEN files.state IN ('done','verified','dead') AND excluded.size=files.size AND excluded.mod_time=files.mod_time THEN files.state
+    ELSE 'stable'
+  END
+`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	now := time.Now()
+	n := 0
+	for i, d := range downs {
+		for _, f := range done {
+			p, ok := downstreamPath(d, f.dstRemote, f.dstPath, f.path)
+			if !ok || p == "" {
+				continue
+			}
+			if d.MinFileSizeBytes > 0 && f.size < d.MinFileSizeBytes {
+				continue
+			}
+			mt, _ := time.Parse(time.RFC3339, f.modTime)
+			if !filters[i].Match(p, f.size, mt, now) {
+				continue
+			}
+			if _, err := stmt.ExecContext(ctx, d.ID, p, f.size, f.modTime, now.Unix(), upstream.ID, f.path, priorities[i].PriorityOf(p), now.Unix()); err != nil {
+				return 0, err
+			}
+			n++
+		}
+	}
+	return n, tx.Commit()
+}
+
+func (s *Store) listDownstreamRules(ctx context.Context, upstreamID string) ([]Rule, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT`+ruleColumns+`FROM rules
+WHERE upstream_rule=? AND is_manual=0 AND transfer_mode!='bisync'
+ORDER BY id
+`, upstreamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Rule
+	for rows.Next() {
+		r, err := scanRuleRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// LineageNode is one hop of a file through a pipeline.
+type LineageNode struct {
+	RuleID    string
+	Path      string
+	State     string
+	DstRemote string
+	DstPath   string
+	LastError string
+	// Depth is the hop count from the origin of the chain.
+	Depth int
+}
+
+func (s *Store) lineageNode(ctx context.Context, ruleID, p string) (LineageNode, string, string, bool, error) {
+	n := LineageNode{RuleID: ruleID, Path: p}
+	var upRule, upPath string
+	err := s.db.QueryRowContext(ctx, `
+SELECT state, dst_remote, dst_path, last_error, upstream_rule_id, upstream_path
+FROM files
+WHERE rule_id=? AND path=?
+`, ruleID, p).Scan(&n.State, &n.DstRemote, &n.DstPath, &n.LastError, &upRule, &upPath)
+	if errors.Is(err, sql.ErrNoRows) {
+		return LineageNode{}, "", "", false, nil
+	}
+	if err != nil {
+		return LineageNode{}, "", "", false, err
+	}
+	return n, upRule, upPath, true, nil
+}
+
+// FileLineage returns the pipeline hops of a file: its upstream chain back to the origin,
+// the file itself and everything fed downstream from it, in hop order.
+func (s *Store) FileLineage(ctx context.Context, ruleID, p string) ([]LineageNode, error) {
+	self, upRule, upPath, ok, err := s.lineageNode(ctx, ruleID, p)
+	if err != nil || !ok {
+		return nil, err
+	}
+	chain := []LineageNode{self}
+	for i := 0; upRule != "" && i < maxPipelineDepth; i++ {
+		var n LineageNode
+		n, upRule, upPath, ok, err = s.lineageNode(ctx, upRule, upPath)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		chain = append([]LineageNode{n}, chain...)
+	}
+	for i := range chain {
+		chain[i].Depth = i
+	}
+
+	// Walk downstream breadth-first; fan-out replicas make this a tree.
+	queue := []LineageNode{self}
+	queue[0].Depth = len(chain) - 1
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur.Depth >= maxPipelineDepth {
+			continue
+		}
+		rows, err := s.db.QueryContext(ctx, `
+SELECT rule_id, path, state, dst_remote, dst_path, last_error
+FROM files
+WHERE upstream_rule_id=? AND upstream_path=?
+ORDER BY rule_id
+`, cur.RuleID, cur.Path)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			n := LineageNode{Depth: cur.Depth + 1}
+			if err := rows.Scan(&n.RuleID, &n.Path, &n.State, &n.DstRemote, &n.DstPath, &n.LastError); err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			chain = append(chain, n)
+			queue = append(queue, n)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return chain, nil
+}
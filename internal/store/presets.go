@@ -4,11 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 )
 
 func (s *Store) ListExtensionPresets(ctx context.Context) ([]ExtensionPreset, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT name, extensions, updated_at FROM extension_presets ORDER BY name`)
+	rows, err := s.db.QueryContext(ctx, `SELECT name, extensions, filters, updated_at FROM extension_presets ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
@@ -17,7 +18,7 @@ func (s *Store) ListExtensionPresets(ctx context.Context) ([]ExtensionPreset, er
 	for rows.Next() {
 		var p ExtensionPreset
 		var updated int64
-		if err := rows.Scan(&p.Name, &p.Extensions, &updated); err != nil {
+		if err := rows.Scan(&p.Name, &p.Extensions, &p.Filters, &updated); err != nil {
 			return nil, err
 		}
 		p.UpdatedAt = time.Unix(updated, 0)
@@ -29,7 +30,7 @@ func (s *Store) ListExtensionPresets(ctx context.Context) ([]ExtensionPreset, er
 func (s *Store) GetExtensionPreset(ctx context.Context, name string) (ExtensionPreset, bool, error) {
 	var p ExtensionPreset
 	var updated int64
-	err := s.db.QueryRowContext(ctx, `SELECT name, extensions, updated_at FROM extension_presets WHERE name=?`, name).Scan(&p.Name, &p.Extensions, &updated)
+	err := s.db.QueryRowContext(ctx, `SELECT name, extensions, filters, updated_at FROM extension_presets WHERE name=?`, name).Scan(&p.Name, &p.Extensions, &p.Filters, &updated)
 	if errors.Is(err, sql.ErrNoRows) {
 		return ExtensionPreset{}, false, nil
 	}
@@ -41,14 +42,19 @@ func (s *Store) GetExtensionPreset(ctx context.Context, name string) (ExtensionP
 }
 
 func (s *Store) UpsertExtensionPreset(ctx context.Context, p ExtensionPreset) error {
+	p.Filters = strings.TrimSpace(p.Filters)
+	if err := new(FileFilter).add(p.Filters, nil, true); err != nil {
+		return err
+	}
 	now := nowUnix()
 	_, err := s.db.ExecContext(ctx, `
-INSERT INTO extension_presets(name, extensions, updated_at)
-VALUES(?, ?, ?)
+INSERT INTO extension_presets(name, extensions, filters, updated_at)
+VALUES(?, ?, ?, ?)
 ON CONFLICT(name) DO UPDATE SET
   extensions=excluded.extensions,
+  filters=excluded.filters,
   updated_at=excluded.updated_at
-`, p.Name, p.Extensions, now)
+`, p.Name, p.Extensions, p.Filters, now)
 	return err
 }
 
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueueOrders lists the valid rule.queue_order values; "" keeps the original order
+// (most recently scanned first).
+var QueueOrders = []string{"", "oldest", "fifo", "smallest", "largest", "path"}
+
+// queueOrderBy is the ORDER BY clause EnqueueStable and ClaimQueuedForJob use for a rule:
+// pinned files first (most recently pinned on top), then by priority, then by the rule's order.
+func queueOrderBy(order string) string {
+	by := "last_seen DESC"
+	switch order {
+	case "oldest":
+		by = "mod_time ASC"
+	case "fifo":
+		by = "first_seen ASC"
+	case "smallest":
+		by = "size ASC"
+	case "largest":
+		by = "size DESC"
+	case "path":
+		by = "path ASC"
+	}
+	return "pinned_at DESC, priority DESC, " + by + ", path ASC"
+}
+
+func validQueueOrder(order string) bool {
+	for _, o := range QueueOrders {
+		if o == order {
+			return true
+		}
+	}
+	return false
+}
+
+// rule.priority_rules holds one "<pattern> <priority>" per line; the first matching line sets
+// the priority of a file (default 0, higher goes first, negative values sink). Patterns use the
+// filter glob syntax, or re: for a regular expression:
+//
+//	/Urgent/**      100
+//	re:\.nfo$       -10
+
+// PriorityRules is a parsed rule.priority_rules. A nil PriorityRules gives every file priority 0.
+type PriorityRules []priorityRule
+
+type priorityRule struct {
+	re       *regexp.Regexp
+	priority int
+}
+
+// ParsePriorityRules parses rule.priority_rules.
+func ParsePriorityRules(raw string) (PriorityRules, error) {
+	var out PriorityRules
+	for i, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		j := strings.LastIndexAny(line, " \t")
+		if j < 0 {
+			return nil, fmt.Errorf("priority line %d: expected \"<pattern> <priority>\": %q", i+1, line)
+		}
+		pat := strings.TrimSpace(line[:j])
+		n, err := strconv.Atoi(line[j+1:])
+		if err != nil {
+			return nil, fmt.Errorf("priority line %d: invalid priority %q", i+1, line[j+1:])
+		}
+		var re *regexp.Regexp
+		if expr, ok := strings.CutPrefix(pat, "re:"); ok {
+			re, err = regexp.Compile(expr)
+		} else {
+			re, err = globRegexp(pat)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("priority line %d: %w", i+1, err)
+		}
+		out = append(out, priorityRule{re: re, priority: n})
+	}
+	return out, nil
+}
+
+// PriorityOf returns the priority of the file at p (relative to the source root).
+func (r PriorityRules) PriorityOf(p string) int {
+	for _, l := range r {
+		if l.re.MatchString(p) {
+			return l.priority
+		}
+	}
+	return 0
+}
+
+// QueueEntry is a file waiting to be transferred, as listed on the rule queue page.
+type QueueEntry struct {
+	Path      string
+	Size      int64
+	ModTime   time.Time
+	State     string
+	Priority  int
+	Pinned    bool
+	FirstSeen time.Time
+	// NextAttempt is when a file that failed before may be retried; zero when it may go now.
+	NextAttempt time.Time
+	LastError   string
+}
+
+// ListRuleQueue returns up to limit waiting files of the rule in the order they will be
+// transferred: queued files first, then stable ones, each in the rule's queue order.
+func (s *Store) ListRuleQueue(ctx context.Context, rule Rule, limit int) ([]QueueEntry, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT path, size, mod_time, state, priority, pinned_at, first_seen, next_attempt_at, last_error
+FROM files
+WHERE rule_id=? AND state IN ('queued','stable')
+ORDER BY state='queued' DESC, `+queueOrderBy(rule.QueueOrder)+`
+LIMIT ?
+`, rule.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []QueueEntry
+	for rows.Next() {
+		var e QueueEntry
+		var mod string
+		var pinned, first, next int64
+		if err := rows.Scan(&e.Path, &e.Size, &mod, &e.State, &e.Priority, &pinned, &first, &next, &e.LastError); err != nil {
+			return nil, err
+		}
+		e.ModTime, _ = time.Parse(time.RFC3339, mod)
+		e.Pinned = pinned > 0
+		e.FirstSeen = time.Unix(first, 0)
+		if next > time.Now().Unix() {
+			e.NextAttempt = time.Unix(next, 0)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// PinFiles moves files of the rule to the front of its queue (pin) or back to their normal
+// place. Pinned stable, failed or dead files are queued right away, skipping any retry backoff;
+// files that are transferring or done are left alone. It returns the number of files changed.
+func (s *Store) PinFiles(ctx context.Context, ruleID string, paths []string, pin bool) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	// Later pins go in front of earlier ones; the counter keeps the order within one call.
+	at := time.Now().UnixNano()
+	var n int64
+	for i := len(paths) - 1; i >= 0; i-- {
+		var res sql.Result
+		if pin {
+			res, err = tx.ExecContext(ctx, `
+UPDATE files
+SET pinned_at=?,
+    state=CASE WHEN state IN ('stable','failed','dead') THEN 'queued' ELSE state END,
+    last_error=CASE WHEN state IN ('failed','dead') THEN '' ELSE last_error END,
+    error_permanent=CASE WHEN state IN ('failed','dead') THEN 0 ELSE error_permanent END,
+    job_id=CASE WHEN state IN ('failed','dead') THEN NULL ELSE job_id END,
+    fail_count=CASE WHEN state='dead' THEN 0 ELSE fail_count END,
+    next_attempt_at=0
+WHERE rule_id=? AND path=? AND state IN ('new','stable','queued','failed','dead')
+`, at, ruleID, paths[i])
+			at++
+		} else {
+			res, err = tx.ExecContext(ctx, `
+UPDATE files SET pinned_at=0 WHERE rule_id=? AND path=? AND pinned_at>0
+`, ruleID, paths[i])
+		}
+		if err != nil {
+			return 0, err
+		}
+		k, _ := res.RowsAffected()
+		n += k
+	}
+	return n, tx.Commit()
+}
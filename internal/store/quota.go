@@ -0,0 +1,59 @@
+package store
+
+import "time"
+
+// QuotaPeriod is one of a limit group's quotas as seen at a given time.
+type QuotaPeriod struct {
+	Name  string // "day", "week" or "month"
+	Limit int64  // 0 = unlimited
+	// Since is the start of the usage window the quota applies to.
+	Since time.Time
+	// Reset is when the window starts over; zero for rolling windows.
+	Reset time.Time
+}
+
+// Location returns the time zone the group's fixed resets are computed in.
+func (g LimitGroup) Location() *time.Location {
+	if g.Timezone != "" {
+		if loc, err := time.LoadLocation(g.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// QuotaPeriods returns the group's quotas at now: the daily one always comes first, the weekly
+// and monthly ones follow when they are set.
+func (g LimitGroup) QuotaPeriods(now time.Time) []QuotaPeriod {
+	var day, week, month QuotaPeriod
+	if g.ResetMode != "fixed" {
+		day = QuotaPeriod{Since: now.Add(-24 * time.Hour)}
+		week = QuotaPeriod{Since: now.Add(-7 * 24 * time.Hour)}
+		month = QuotaPeriod{Since: now.Add(-30 * 24 * time.Hour)}
+	} else {
+		loc := g.Location()
+		at, _ := parseClock(g.ResetTime)
+		t := now.In(loc)
+		d := time.Date(t.Year(), t.Month(), t.Day(), at/60, at%60, 0, 0, loc)
+		if d.After(t) {
+			d = d.AddDate(0, 0, -1)
+		}
+		// A quota day is named after the date it starts on; weeks start on Monday.
+		w := d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+		m := time.Date(d.Year(), d.Month(), 1, at/60, at%60, 0, 0, loc)
+		day = QuotaPeriod{Since: d, Reset: d.AddDate(0, 0, 1)}
+		week = QuotaPeriod{Since: w, Reset: w.AddDate(0, 0, 7)}
+		month = QuotaPeriod{Since: m, Reset: m.AddDate(0, 1, 0)}
+	}
+	day.Name, day.Limit = "day", g.DailyLimitBytes
+	out := []QuotaPeriod{day}
+	if g.WeeklyLimitBytes > 0 {
+		week.Name, week.Limit = "week", g.WeeklyLimitBytes
+		out = append(out, week)
+	}
+	if g.MonthlyLimitBytes > 0 {
+		month.Name, month.Limit = "month", g.MonthlyLimitBytes
+		out = append(out, month)
+	}
+	return out
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// A quota pause stops new jobs for a scope after the provider reported its quota as used up
+// (see the daemon's quota error classification). Scopes are "rule:<id>" for ungrouped rules,
+// "group:<name>" for a limit group's own destinations, "group:<name>:<remote>" for one of
+// its fallbacks and "sa:<name>:<account>" for one of its service accounts.
+
+// QuotaPause is a scope whose provider quota is exhausted until Until.
+type QuotaPause struct {
+	Scope     string
+	Until     time.Time
+	Reason    string
+	CreatedAt time.Time
+}
+
+// RuleQuotaScope is the quota pause scope of an ungrouped rule.
+func RuleQuotaScope(ruleID string) string { return "rule:" + ruleID }
+
+// GroupQuotaScope is the quota pause scope of a limit group; dstRemote selects a fallback
+// ("" = the rules' own destinations).
+func GroupQuotaScope(group, dstRemote string) string {
+	if dstRemote == "" {
+		return "group:" + group
+	}
+	return "group:" + group + ":" + dstRemote
+}
+
+// PauseQuota marks scope as exhausted until until; an existing pause is extended, never shortened.
+func (s *Store) PauseQuota(ctx context.Context, scope string, until time.Time, reason string) error {
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO quota_pauses(scope, until, reason, created_at)
+VALUES(?, ?, ?, ?)
+ON CONFLICT(scope) DO UPDATE SET
+  until=MAX(quota_pauses.until, excluded.until),
+  reason=excluded.reason,
+  created_at=excluded.created_at
+`, scope, until.Unix(), reason, nowUnix())
+	return err
+}
+
+// QuotaPausedUntil returns the pause of scope if it is still in effect at now.
+func (s *Store) QuotaPausedUntil(ctx context.Context, scope string, now time.Time) (QuotaPause, bool, error) {
+	var p QuotaPause
+	var until, created int64
+	err := s.db.QueryRowContext(ctx, `SELECT scope, until, reason, created_at FROM quota_pauses WHERE scope=? AND until>?`, scope, now.Unix()).
+		Scan(&p.Scope, &until, &p.Reason, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return QuotaPause{}, false, nil
+	}
+	if err != nil {
+		return QuotaPause{}, false, err
+	}
+	p.Until = time.Unix(until, 0)
+	p.CreatedAt = time.Unix(created, 0)
+	return p, true, nil
+}
+
+// ListQuotaPauses returns the pauses in effect at now, keyed by scope. Expired ones are dropped.
+func (s *Store) ListQuotaPauses(ctx context.Context, now time.Time) (map[string]QuotaPause, error) {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM quota_pauses WHERE until<=?`, now.Unix()); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT scope, until, reason, created_at FROM quota_pauses`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]QuotaPause{}
+	for rows.Next() {
+		var p QuotaPause
+		var until, created int64
+		if err := rows.Scan(&p.Scope, &until, &p.Reason, &created); err != nil {
+			return nil, err
+		}
+		p.Until = time.Unix(until, 0)
+		p.CreatedAt = time.Unix(created, 0)
+		out[p.Scope] = p
+	}
+	return out, rows.Err()
+}
+
+// ClearQuotaPause lifts the pause of scope.
+func (s *Store) ClearQuotaPause(ctx context.Context, scope string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM quota_pauses WHERE scope=?`, scope)
+	return err
+}
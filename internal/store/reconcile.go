@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (r *Rule) normalizeSeedFromDest() error {
+	if !r.SeedFromDest {
+		return nil
+	}
+	if r.IsManual || (r.TransferMode != "copy" && r.TransferMode != "sync") {
+		return errors.New("seed_from_dest is only supported for copy and sync rules")
+	}
+	if HasDstPlaceholders(r.DstPath) {
+		return errors.New("seed_from_dest needs a dst_path without placeholders")
+	}
+	return nil
+}
+
+// CanReconcileDest reports whether the rule's files can be reconciled with a listing of its
+// destination: copy and sync rules whose files all go to dst_path as they are.
+func (r Rule) CanReconcileDest() bool {
+	return !r.IsManual && (r.TransferMode == "copy" || r.TransferMode == "sync") && !HasDstPlaceholders(r.DstPath)
+}
+
+// DestFile is a file listed at a rule's destination.
+type DestFile struct {
+	Size int64
+	// HashMatched is set when a hash of the source file matched; otherwise only the size did.
+	HashMatched bool
+}
+
+// DestReconcile is the outcome of the last reconciliation of a rule with its destination.
+type DestReconcile struct {
+	RuleID string
+	At     time.Time
+	// DestFiles is the number of files listed at the destination, minus those whose hash
+	// differs from the source.
+	DestFiles int
+	// Seeded files were pending but already at the destination and were marked done.
+	Seeded int64
+	// Requeued files were done but missing (or different) at the destination.
+	Requeued int64
+	Error    string
+}
+
+// ReconcileDest compares the rule's files with a listing of its destination, keyed by paths
+// relative to dst_path (files known to differ by hash are left out). Pending files the
+// destination already has with the same size are marked done without a transfer; unless their
+// hash matched too, they are marked done_unconfirmed, which keeps source cleanup away from them.
+// With requeueMissing, done files the destination lacks are queued again. Files sent to a group
+// fallback remote and files whose source copy was cleaned up are left alone.
+func (s *Store) ReconcileDest(ctx context.Context, rule Rule, dest map[string]DestFile, requeueMissing bool) (DestReconcile, error) {
+	res := DestReconcile{RuleID: rule.ID, At: time.Now(), DestFiles: len(dest)}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT path, size, state, dst_remote, source_deleted_at
+FROM files
+WHERE rule_id=? AND state IN ('new','stable','queued','failed','dead','done','verified')
+`, rule.ID)
+	if err != nil {
+		return res, err
+	}
+	var seed, seedUnconfirmed, requeue []string
+	for rows.Next() {
+		var p, state, dstRemote string
+		var size, deletedAt int64
+		if err := rows.Scan(&p, &size, &state, &dstRemote, &deletedAt); err != nil {
+			rows.Close()
+			return res, err
+		}
+		got, ok := dest[p]
+		switch state {
+		case "done", "verified":
+			if requeueMissing && (!ok || got.Size != size) && deletedAt == 0 && (dstRemote == "" || dstRemote == rule.DstRemote) {
+				requeue = append(requeue, p)
+			}
+		default:
+			switch {
+			case !ok || got.Size != size:
+			case got.HashMatched:
+				seed = append(seed, p)
+			default:
+				seedUnconfirmed = append(seedUnconfirmed, p)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return res, err
+	}
+	rows.Close()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	exec := func(q string, paths []string, args ...any) (int64, error) {
+		if len(paths) == 0 {
+			return 0, nil
+		}
+		stmt, err := tx.PrepareContext(ctx, q)
+		if err != nil {
+			return 0, err
+		}
+		defer stmt.Close()
+		var n int64
+		for _, p := range paths {
+			r, err := stmt.ExecContext(ctx, append(args, rule.ID, p)...)
+			if err != nil {
+				return 0, err
+			}
+			k, _ := r.RowsAffected()
+			n += k
+		}
+		return n, nil
+	}
+	const seedQuery = `
+UPDATE files
+SET state='done', job_id=NULL, dst_remote=?, dst_path=?, last_error='', error_permanent=0, next_attempt_at=0, pinned_at=0, done_at=?, done_unconfirmed=?, source_deleted_at=0
+WHERE rule_id=? AND path=? AND state IN ('new','stable','queued','failed','dead')
+`
+	for i, paths := range [][]string{seed, seedUnconfirmed} {
+		n, err := exec(seedQuery, paths, rule.DstRemote, rule.DstPath, nowUnix(), i)
+		if err != nil {
+			return res, err
+		}
+		res.Seeded += n
+	}
+	if res.Requeued, err = exec(`
+UPDATE files
+SET state='queued', job_id=NULL, last_error='', error_permanent=0, fail_count=0, next_attempt_at=0, done_at=0, done_unconfirmed=0
+WHERE rule_id=? AND path=? AND state IN ('done','verified')
+`, requeue); err != nil {
+		return res, err
+	}
+	if err := saveDestReconcile(ctx, tx, res); err != nil {
+		return res, err
+	}
+	return res, tx.Commit()
+}
+
+// RecordDestReconcileError records a reconciliation that failed before touching any file.
+func (s *Store) RecordDestReconcileError(ctx context.Context, ruleID, errMsg string) error {
+	return saveDestReconcile(ctx, s.db, DestReconcile{RuleID: ruleID, At: time.Now(), Error: errMsg})
+}
+
+func saveDestReconcile(ctx context.Context, db execer, r DestReconcile) error {
+	_, err := db.ExecContext(ctx, `
+INSERT INTO dest_reconciles(rule_id, at, dest_files, seeded, requeued, error)
+VALUES(?, ?, ?, ?, ?, ?)
+ON CONFLICT(rule_id) DO UPDATE SET
+  at=excluded.at,
+  dest_files=excluded.dest_files,
+  seeded=excluded.seeded,
+  requeued=excluded.requeued,
+  error=excluded.error
+`, r.RuleID, r.At.Unix(), r.DestFiles, r.Seeded, r.Requeued, r.Error)
+	return err
+}
+
+// GetDestReconcile returns the rule's last reconciliation; ok is false when it never ran.
+func (s *Store) GetDestReconcile(ctx context.Context, ruleID string) (DestReconcile, bool, error) {
+	r := DestReconcile{RuleID: ruleID}
+	var at int64
+	err := s.db.QueryRowContext(ctx, `
+SELECT at, dest_files, seeded, requeued, error
+FROM dest_reconciles
+WHERE rule_id=?
+`, ruleID).Scan(&at, &r.DestFiles, &r.Seeded, &r.Requeued, &r.Error)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DestReconcile{}, false, nil
+	}
+	if err != nil {
+		return DestReconcile{}, false, err
+	}
+	r.At = time.Unix(at, 0)
+	return r, true, nil
+}
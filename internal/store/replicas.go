@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// A fan-out rule copies the same source to several destinations. Every extra destination is a
+// hidden replica rule ("<parent>@<n>", parent_id set) with its own files state, jobs and limit
+// group; only the parent scans, and it feeds the scan results into every replica.
+
+// ReplicaDest is one extra destination of a fan-out rule.
+type ReplicaDest struct {
+	DstRemote  string
+	DstPath    string
+	LimitGroup string
+}
+
+func (r Rule) Dest() ReplicaDest {
+	return ReplicaDest{DstRemote: r.DstRemote, DstPath: r.DstPath, LimitGroup: r.LimitGroup}
+}
+
+func replicaOf(parent Rule, id string, d ReplicaDest) Rule {
+	r := parent
+	r.ID = id
+	r.ParentID = parent.ID
+	r.DstRemote = d.DstRemote
+	r.DstPath = d.DstPath
+	r.LimitGroup = d.LimitGroup
+	return r
+}
+
+func (s *Store) ListReplicas(ctx context.Context, parentID string) ([]Rule, error) {
+	if parentID == "" {
+		return nil, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT`+ruleColumns+`FROM rules
+WHERE parent_id=?
+ORDER BY CAST(substr(id, length(parent_id)+2) AS INTEGER)
+`, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Rule
+	for rows.Next() {
+		r, err := scanRuleRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SetRuleReplicas replaces the extra destinations of parent. A replica whose destination changed
+// is recreated, since the files it tracked as done refer to the old destination.
+func (s *Store) SetRuleReplicas(ctx context.Context, parent Rule, dests []ReplicaDest) error {
+	if err := parent.Normalize(); err != nil {
+		return err
+	}
+	if len(dests) > 0 && parent.TransferMode != "copy" {
+		return errors.New("multiple destinations require transfer_mode=copy")
+	}
+	existing, err := s.ListReplicas(ctx, parent.ID)
+	if err != nil {
+		return err
+	}
+	byID := map[string]Rule{}
+	for _, r := range existing {
+		byID[r.ID] = r
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for i, d := range dests {
+		want := replicaOf(parent, fmt.Sprintf("%s@%d", parent.ID, i+1), d)
+		if err := want.Normalize(); err != nil {
+			return fmt.Errorf("destination %d: %w", i+1, err)
+		}
+		if old, ok := byID[want.ID]; ok && (old.DstRemote != want.DstRemote || old.DstPath != want.DstPath) {
+			if err := deleteRules(ctx, tx, "id=?", old.ID); err != nil {
+				return err
+			}
+		}
+		delete(byID, want.ID)
+		if err := upsertRule(ctx, tx, want); err != nil {
+			return err
+		}
+	}
+	for id := range byID {
+		if err := deleteRules(ctx, tx, "id=?", id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FanoutDoneCount counts files of a fan-out rule that are done at every destination.
+func (s *Store) FanoutDoneCount(ctx context.Context, parentID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+SELECT COUNT(*)
+FROM files f
+WHERE f.rule_id=? AND f.state IN ('done','verified')
+  AND NOT EXISTS (
+    SELECT 1 FROM rules r
+    WHERE r.parent_id=f.rule_id
+      AND NOT EXISTS (SELECT 1 FROM files g WHERE g.rule_id=r.id AND g.path=f.path AND g.state IN ('done','verified'))
+  )
+`, parentID).Scan(&n)
+	return n, err
+}
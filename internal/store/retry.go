@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy decides what happens to the files of a failed job (settings retry_max_attempts /
+// retry_backoff_sec). Each failure counts in files.fail_count; below MaxAttempts the file is
+// queued again after an exponential backoff (files.next_attempt_at), at MaxAttempts it becomes
+// 'dead' and waits for a manual requeue; so does a file whose error is permanent (see
+// FileError). MaxAttempts <= 0 turns automatic retries off: failed files stay 'failed' until
+// retried by hand.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+// maxRetryBackoff caps the delay between two attempts.
+const maxRetryBackoff = 24 * time.Hour
+
+// Delay returns how long a file that failed failCount times waits before its next attempt:
+// Backoff, 2×Backoff, 4×Backoff, ... up to a day.
+func (p RetryPolicy) Delay(failCount int) time.Duration {
+	d := p.Backoff
+	if d <= 0 {
+		d = time.Minute
+	}
+	for i := 1; i < failCount && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d
+}
+
+// FileError is why rclone failed one file of a job, as reported in the job log.
+type FileError struct {
+	Reason string
+	// Permanent errors (a name the destination refuses, a file that is too large) fail the same
+	// way on every attempt, so the file is not retried.
+	Permanent bool
+}
+
+// DeadFile is a file that used up its retries.
+type DeadFile struct {
+	Path      string
+	Size      int64
+	FailCount int
+	LastError string
+	Permanent bool // LastError is one retrying cannot fix
+	JobID     string
+	LastSeen  time.Time
+}
+
+// ListDeadFiles returns up to limit dead files of the rule, most recently seen first.
+func (s *Store) ListDeadFiles(ctx context.Context, ruleID string, limit int) ([]DeadFile, error) {
+	if limit <= 0 {
+		limit = 500
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT path, size, fail_count, last_error, error_permanent, COALESCE(job_id, ''), last_seen
+FROM files
+WHERE rule_id=? AND state='dead'
+ORDER BY last_seen DESC, path ASC
+LIMIT ?
+`, ruleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []DeadFile
+	for rows.Next() {
+		var f DeadFile
+		var seen, permanent int64
+		if err := rows.Scan(&f.Path, &f.Size, &f.FailCount, &f.LastError, &permanent, &f.JobID, &seen); err != nil {
+			return nil, err
+		}
+		f.LastSeen = time.Unix(seen, 0)
+		f.Permanent = permanent != 0
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// RequeueDead queues dead files of the rule again with a fresh retry budget; no paths means all
+// of them. It returns the number of files requeued.
+func (s *Store) RequeueDead(ctx context.Context, ruleID string, paths []string) (int64, error) {
+	const q = `
+UPDATE files
+SET state='queued', job_id=NULL, last_error='', error_permanent=0, fail_count=0, next_attempt_at=0
+WHERE rule_id=? AND state='dead'`
+	if len(paths) == 0 {
+		res, err := s.db.ExecContext(ctx, q, ruleID)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	var n int64
+	for _, p := range paths {
+		res, err := tx.ExecContext(ctx, q+` AND path=?`, ruleID, p)
+		if err != nil {
+			return 0, err
+		}
+		k, _ := res.RowsAffected()
+		n += k
+	}
+	return n, tx.Commit()
+}
@@ -7,15 +7,51 @@ import (
 	"time"
 )
 
-func (s *Store) ListRules(ctx context.Context) ([]Rule, error) {
-	rows, err := s.db.QueryContext(ctx, `
-SELECT id, limit_group, src_kind, src_remote, src_path, src_local_root, local_watch_enabled,
-       dst_remote, dst_path, transfer_mode, rclone_extra_args, ignore_extensions, bwlimit,
+const ruleColumns = `
+       id, parent_id, upstream_rule, limit_group, src_kind, src_remote, src_path, src_local_root, local_watch_enabled,
+       dst_remote, dst_path, transfer_mode, max_delete, conflict_policy, verify_mode, rclone_extra_args, ignore_extensions, filters, bwlimit,
+       job_schedule, scan_schedule, window_policy, window_bwlimit,
        daily_limit_bytes, min_file_size_bytes, is_manual,
-       max_parallel_jobs, scan_interval_sec, stable_seconds, batch_size, enabled,
+       max_parallel_jobs, scan_interval_sec, stable_seconds, batch_size, batch_max_bytes, queue_order, priority_rules,
+       missing_action, missing_grace_scans, source_delete_after_days, source_delete_watermark, source_trash_dir, seed_from_dest, scan_strategy, full_scan_interval_sec, enabled,
        created_at, updated_at
-FROM rules
-WHERE is_manual=0
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRuleRow(row rowScanner) (Rule, error) {
+	var r Rule
+	var enabled int
+	var watch int
+	var seed int
+	var isManual int
+	var created, updated int64
+	if err := row.Scan(
+		&r.ID, &r.ParentID, &r.UpstreamRule, &r.LimitGroup, &r.SrcKind, &r.SrcRemote, &r.SrcPath, &r.SrcLocalRoot, &watch,
+		&r.DstRemote, &r.DstPath, &r.TransferMode, &r.MaxDelete, &r.ConflictPolicy, &r.VerifyMode, &r.RcloneExtraArgs, &r.IgnoreExtensions, &r.Filters, &r.Bwlimit,
+		&r.JobSchedule, &r.ScanSchedule, &r.WindowPolicy, &r.WindowBwlimit,
+		&r.DailyLimitBytes, &r.MinFileSizeBytes, &isManual,
+		&r.MaxParallelJobs, &r.ScanIntervalSec, &r.StableSeconds, &r.BatchSize, &r.BatchMaxBytes, &r.QueueOrder, &r.PriorityRules,
+		&r.MissingAction, &r.MissingGraceScans, &r.SourceDeleteAfterDays, &r.SourceDeleteWatermark, &r.SourceTrashDir, &seed, &r.ScanStrategy, &r.FullScanIntervalSec, &enabled,
+		&created, &updated,
+	); err != nil {
+		return Rule{}, err
+	}
+	r.Enabled = enabled != 0
+	r.LocalWatch = watch != 0
+	r.SeedFromDest = seed != 0
+	r.IsManual = isManual != 0
+	r.CreatedAt = time.Unix(created, 0)
+	r.UpdatedAt = time.Unix(updated, 0)
+	return r, nil
+}
+
+func (s *Store) ListRules(ctx context.Context) ([]Rule, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT`+ruleColumns+`FROM rules
+WHERE is_manual=0 AND parent_id=''
 ORDER BY id
 `)
 	if err != nil {
@@ -24,80 +60,93 @@ ORDER BY id
 	defer rows.Close()
 	var out []Rule
 	for rows.Next() {
-		var r Rule
-		var enabled int
-		var watch int
-		var isManual int
-		var created, updated int64
-		if err := rows.Scan(
-			&r.ID, &r.LimitGroup, &r.SrcKind, &r.SrcRemote, &r.SrcPath, &r.SrcLocalRoot, &watch,
-			&r.DstRemote, &r.DstPath, &r.TransferMode, &r.RcloneExtraArgs, &r.IgnoreExtensions, &r.Bwlimit,
-			&r.DailyLimitBytes, &r.MinFileSizeBytes, &isManual,
-			&r.MaxParallelJobs, &r.ScanIntervalSec, &r.StableSeconds, &r.BatchSize, &enabled,
-			&created, &updated,
-		); err != nil {
+		r, err := scanRuleRow(rows)
+		if err != nil {
 			return nil, err
 		}
-		r.Enabled = enabled != 0
-		r.LocalWatch = watch != 0
-		r.IsManual = isManual != 0
-		r.CreatedAt = time.Unix(created, 0)
-		r.UpdatedAt = time.Unix(updated, 0)
 		out = append(out, r)
 	}
 	return out, rows.Err()
 }
 
 func (s *Store) GetRule(ctx context.Context, id string) (Rule, bool, error) {
-	var r Rule
-	var enabled int
-	var watch int
-	var isManual int
-	var created, updated int64
-	err := s.db.QueryRowContext(ctx, `
-SELECT id, limit_group, src_kind, src_remote, src_path, src_local_root, local_watch_enabled,
-       dst_remote, dst_path, transfer_mode, rclone_extra_args, ignore_extensions, bwlimit,
-       daily_limit_bytes, min_file_size_bytes, is_manual,
-       max_parallel_jobs, scan_interval_sec, stable_seconds, batch_size, enabled,
-       created_at, updated_at
-FROM rules
+	r, err := scanRuleRow(s.db.QueryRowContext(ctx, `
+SELECT`+ruleColumns+`FROM rules
 WHERE id=?
-`, id).Scan(
-		&r.ID, &r.LimitGroup, &r.SrcKind, &r.SrcRemote, &r.SrcPath, &r.SrcLocalRoot, &watch,
-		&r.DstRemote, &r.DstPath, &r.TransferMode, &r.RcloneExtraArgs, &r.IgnoreExtensions, &r.Bwlimit,
-		&r.DailyLimitBytes, &r.MinFileSizeBytes, &isManual,
-		&r.MaxParallelJobs, &r.ScanIntervalSec, &r.StableSeconds, &r.BatchSize, &enabled,
-		&created, &updated,
-	)
+`, id))
 	if errors.Is(err, sql.ErrNoRows) {
 		return Rule{}, false, nil
 	}
 	if err != nil {
 		return Rule{}, false, err
 	}
-	r.Enabled = enabled != 0
-	r.LocalWatch = watch != 0
-	r.IsManual = isManual != 0
-	r.CreatedAt = time.Unix(created, 0)
-	r.UpdatedAt = time.Unix(updated, 0)
 	return r, true, nil
 }
 
+// ListRulesWithReplicas is ListRules plus the hidden per-destination replicas of fan-out rules.
+func (s *Store) ListRulesWithReplicas(ctx context.Context) ([]Rule, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT`+ruleColumns+`FROM rules
+WHERE is_manual=0
+ORDER BY id
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Rule
+	for rows.Next() {
+		r, err := scanRuleRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// UpsertRule saves r; for a fan-out rule the shared settings are copied to its replicas.
 func (s *Store) UpsertRule(ctx context.Context, r Rule) error {
+	if err := s.checkUpstream(ctx, r); err != nil {
+		return err
+	}
+	if err := upsertRule(ctx, s.db, r); err != nil {
+		return err
+	}
+	if r.ParentID != "" {
+		return nil
+	}
+	replicas, err := s.ListReplicas(ctx, r.ID)
+	if err != nil {
+		return err
+	}
+	for _, rep := range replicas {
+		if err := upsertRule(ctx, s.db, replicaOf(r, rep.ID, rep.Dest())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upsertRule(ctx context.Context, db execer, r Rule) error {
 	if err := r.Normalize(); err != nil {
 		return err
 	}
 	now := nowUnix()
-	_, err := s.db.ExecContext(ctx, `
+	_, err := db.ExecContext(ctx, `
 INSERT INTO rules(
-  id, limit_group, src_kind, src_remote, src_path, src_local_root, local_watch_enabled,
-  dst_remote, dst_path, transfer_mode, rclone_extra_args, ignore_extensions, bwlimit,
+  id, parent_id, upstream_rule, limit_group, src_kind, src_remote, src_path, src_local_root, local_watch_enabled,
+  dst_remote, dst_path, transfer_mode, max_delete, conflict_policy, verify_mode, rclone_extra_args, ignore_extensions, filters, bwlimit,
+  job_schedule, scan_schedule, window_policy, window_bwlimit,
   daily_limit_bytes, min_file_size_bytes, is_manual,
-  max_parallel_jobs, scan_interval_sec, stable_seconds, batch_size, enabled,
+  max_parallel_jobs, scan_interval_sec, stable_seconds, batch_size, batch_max_bytes, queue_order, priority_rules,
+  missing_action, missing_grace_scans, source_delete_after_days, source_delete_watermark, source_trash_dir, seed_from_dest, scan_strategy, full_scan_interval_sec, enabled,
   created_at, updated_at
 )
-VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 ON CONFLICT(id) DO UPDATE SET
+  parent_id=excluded.parent_id,
+  upstream_rule=excluded.upstream_rule,
   limit_group=excluded.limit_group,
   src_kind=excluded.src_kind,
   src_remote=excluded.src_remote,
@@ -107,8 +156,16 @@ ON CONFLICT(id) DO UPDATE SET
   dst_remote=excluded.dst_remote,
   dst_path=excluded.dst_path,
   transfer_mode=excluded.transfer_mode,
+  max_delete=excluded.max_delete,
+  conflict_policy=excluded.conflict_policy,
+  verify_mode=excluded.verify_mode,
   rclone_extra_args=excluded.rclone_extra_args,
   ignore_extensions=excluded.ignore_extensions,
+  filters=excluded.filters,
+  job_schedule=excluded.job_schedule,
+  scan_schedule=excluded.scan_schedule,
+  window_policy=excluded.window_policy,
+  window_bwlimit=excluded.window_bwlimit,
   bwlimit=excluded.bwlimit,
   daily_limit_bytes=excluded.daily_limit_bytes,
   min_file_size_bytes=excluded.min_file_size_bytes,
@@ -117,19 +174,51 @@ ON CONFLICT(id) DO UPDATE SET
   scan_interval_sec=excluded.scan_interval_sec,
   stable_seconds=excluded.stable_seconds,
   batch_size=excluded.batch_size,
+  batch_max_bytes=excluded.batch_max_bytes,
+  queue_order=excluded.queue_order,
+  priority_rules=excluded.priority_rules,
+  missing_action=excluded.missing_action,
+  missing_grace_scans=excluded.missing_grace_scans,
+  source_delete_after_days=excluded.source_delete_after_days,
+  source_delete_watermark=excluded.source_delete_watermark,
+  source_trash_dir=excluded.source_trash_dir,
+  seed_from_dest=excluded.seed_from_dest,
+  scan_strategy=excluded.scan_strategy,
+  full_scan_interval_sec=excluded.full_scan_interval_sec,
   enabled=excluded.enabled,
   updated_at=excluded.updated_at
-`, r.ID, r.LimitGroup, r.SrcKind, r.SrcRemote, r.SrcPath, r.SrcLocalRoot, boolToInt(r.LocalWatch),
-		r.DstRemote, r.DstPath, r.TransferMode, r.RcloneExtraArgs, r.IgnoreExtensions, r.Bwlimit,
+`, r.ID, r.ParentID, r.UpstreamRule, r.LimitGroup, r.SrcKind, r.SrcRemote, r.SrcPath, r.SrcLocalRoot, boolToInt(r.LocalWatch),
+		r.DstRemote, r.DstPath, r.TransferMode, r.MaxDelete, r.ConflictPolicy, r.VerifyMode, r.RcloneExtraArgs, r.IgnoreExtensions, r.Filters, r.Bwlimit,
+		r.JobSchedule, r.ScanSchedule, r.WindowPolicy, r.WindowBwlimit,
 		r.DailyLimitBytes, r.MinFileSizeBytes, boolToInt(r.IsManual),
-		r.MaxParallelJobs, r.ScanIntervalSec, r.StableSeconds, r.BatchSize, boolToInt(r.Enabled),
+		r.MaxParallelJobs, r.ScanIntervalSec, r.StableSeconds, r.BatchSize, r.BatchMaxBytes, r.QueueOrder, r.PriorityRules,
+		r.MissingAction, r.MissingGraceScans, r.SourceDeleteAfterDays, r.SourceDeleteWatermark, r.SourceTrashDir, boolToInt(r.SeedFromDest), r.ScanStrategy, r.FullScanIntervalSec, boolToInt(r.Enabled),
 		now, now,
 	)
 	return err
 }
 
 func (s *Store) DeleteRule(ctx context.Context, id string) error {
-	_, err := s.db.ExecContext(ctx, `DELETE FROM rules WHERE id=?`, id)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := deleteRules(ctx, tx, "id=? OR parent_id=?", id, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteRules deletes the rules matching cond together with everything kept about them; their
+// files and jobs go with them through the foreign keys.
+func deleteRules(ctx context.Context, db execer, cond string, args ...any) error {
+	for _, table := range []string{"file_events", "source_deletions", "dest_reconciles", "scan_dirs", "rule_scans"} {
+		if _, err := db.ExecContext(ctx, `DELETE FROM `+table+` WHERE rule_id IN (SELECT id FROM rules WHERE `+cond+`)`, args...); err != nil {
+			return err
+		}
+	}
+	_, err := db.ExecContext(ctx, `DELETE FROM rules WHERE `+cond, args...)
 	return err
 }
 
@@ -138,12 +227,7 @@ func (s *Store) GetRulesByGroup(ctx context.Context, group string) ([]Rule, erro
 		return nil, nil
 	}
 	rows, err := s.db.QueryContext(ctx, `
-SELECT id, limit_group, src_kind, src_remote, src_path, src_local_root, local_watch_enabled,
-       dst_remote, dst_path, transfer_mode, rclone_extra_args, ignore_extensions, bwlimit,
-       daily_limit_bytes, min_file_size_bytes, is_manual,
-       max_parallel_jobs, scan_interval_sec, stable_seconds, batch_size, enabled,
-       created_at, updated_at
-FROM rules
+SELECT`+ruleColumns+`FROM rules
 WHERE limit_group=? AND is_manual=0
 `, group)
 	if err != nil {
@@ -152,25 +236,10 @@ WHERE limit_group=? AND is_manual=0
 	defer rows.Close()
 	var out []Rule
 	for rows.Next() {
-		var r Rule
-		var enabled int
-		var watch int
-		var isManual int
-		var created, updated int64
-		if err := rows.Scan(
-			&r.ID, &r.LimitGroup, &r.SrcKind, &r.SrcRemote, &r.SrcPath, &r.SrcLocalRoot, &watch,
-			&r.DstRemote, &r.DstPath, &r.TransferMode, &r.RcloneExtraArgs, &r.IgnoreExtensions, &r.Bwlimit,
-			&r.DailyLimitBytes, &r.MinFileSizeBytes, &isManual,
-			&r.MaxParallelJobs, &r.ScanIntervalSec, &r.StableSeconds, &r.BatchSize, &enabled,
-			&created, &updated,
-		); err != nil {
+		r, err := scanRuleRow(rows)
+		if err != nil {
 			return nil, err
 		}
-		r.Enabled = enabled != 0
-		r.LocalWatch = watch != 0
-		r.IsManual = isManual != 0
-		r.CreatedAt = time.Unix(created, 0)
-		r.UpdatedAt = time.Unix(updated, 0)
 		out = append(out, r)
 	}
 	return out, rows.Err()
@@ -0,0 +1,51 @@
+package store
+
+import "context"
+
+// ScanDirs returns the modification times (as rclone lists them) of the source directories of
+// the rule, by path relative to the source, as of the last scan that listed them.
+func (s *Store) ScanDirs(ctx context.Context, ruleID string) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT path, mod_time FROM scan_dirs WHERE rule_id=?`, ruleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]string{}
+	for rows.Next() {
+		var p, mt string
+		if err := rows.Scan(&p, &mt); err != nil {
+			return nil, err
+		}
+		out[p] = mt
+	}
+	return out, rows.Err()
+}
+
+// SaveScanDirs records the directory modification times a scan listed. A full listing replaces
+// what was recorded before, so directories that are gone are forgotten.
+func (s *Store) SaveScanDirs(ctx context.Context, ruleID string, dirs map[string]string, full bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if full {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM scan_dirs WHERE rule_id=?`, ruleID); err != nil {
+			return err
+		}
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO scan_dirs(rule_id, path, mod_time) VALUES(?, ?, ?)
+ON CONFLICT(rule_id, path) DO UPDATE SET mod_time=excluded.mod_time
+`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for p, mt := range dirs {
+		if _, err := stmt.ExecContext(ctx, ruleID, p, mt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	// scanChunkSize is how many listed files a scan writes per transaction.
+	scanChunkSize = 2000
+	// scanFlushInterval bounds how long listed files wait for a slow listing to fill a chunk, so
+	// progress keeps moving and the files show up early.
+	scanFlushInterval = 5 * time.Second
+)
+
+// ScanProgress is the state of the current or last scan of a rule.
+type ScanProgress struct {
+	RuleID     string
+	StartedAt  time.Time
+	FinishedAt time.Time // zero while the scan runs
+	// Full is false for incremental scans (see Rule.ScanStrategy).
+	Full bool
+	// Listed is the number of files listed so far.
+	Listed int64
+	Error  string
+}
+
+// Running reports whether the scan is still in progress.
+func (p ScanProgress) Running() bool {
+	return !p.StartedAt.IsZero() && p.FinishedAt.IsZero()
+}
+
+// Duration returns how long the scan ran (so far).
+func (p ScanProgress) Duration() time.Duration {
+	if p.StartedAt.IsZero() {
+		return 0
+	}
+	end := p.FinishedAt
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return end.Sub(p.StartedAt).Round(time.Second)
+}
+
+// ScanWriter writes the files of a scan as they are listed into the scanned rule and its fan-out
+// replicas, in transactions of at most scanChunkSize files, and keeps the rule's scan progress
+// up to date; memory use does not grow with the source and the database is never held for long.
+type ScanWriter struct {
+	s       *Store
+	ctx     context.Context
+	targets []scanTarget
+	buf     []ScanEntry
+	listed  int64
+	flushed time.Time
+}
+
+// NewScanWriter starts a scan of rules[0] whose files are written into every rule of rules.
+func (s *Store) NewScanWriter(ctx context.Context, rules []Rule, full bool) (*ScanWriter, error) {
+	if len(rules) == 0 {
+		return nil, errors.New("no rule to scan")
+	}
+	w := &ScanWriter{s: s, ctx: ctx, buf: make([]ScanEntry, 0, scanChunkSize), flushed: time.Now()}
+	for _, r := range rules {
+		t, err := s.newScanTarget(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		w.targets = append(w.targets, t)
+	}
+	if _, err := s.db.ExecContext(ctx, `
+INSERT INTO rule_scans(rule_id, started_at, finished_at, full, listed, error)
+VALUES(?, ?, 0, ?, 0, '')
+ON CONFLICT(rule_id) DO UPDATE SET
+  started_at=excluded.started_at,
+  finished_at=0,
+  full=excluded.full,
+  listed=0,
+  error=''
+`, rules[0].ID, nowUnix(), boolToInt(full)); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Add queues a listed file, writing the queue out once it is full or has waited long enough.
+func (w *ScanWriter) Add(e ScanEntry) error {
+	w.buf = append(w.buf, e)
+	w.listed++
+	if len(w.buf) >= scanChunkSize || time.Since(w.flushed) >= scanFlushInterval {
+		return w.flush(false)
+	}
+	return nil
+}
+
+// Close writes out the remaining files and records the end of the scan. listErr is the error
+// the listing ended with, if any; the files listed before it are kept, but only a complete
+// listing drops pending files the rules' size limits or filters exclude by now.
+func (w *ScanWriter) Close(listErr error) error {
+	err := w.flush(listErr == nil)
+	msg := ""
+	if listErr != nil {
+		msg = listErr.Error()
+	} else if err != nil {
+		msg = err.Error()
+	}
+	// The scan's context may be gone; the end of the scan is recorded regardless.
+	if _, uerr := w.s.db.ExecContext(context.Background(), `
+UPDATE rule_scans SET finished_at=?, listed=?, error=? WHERE rule_id=?
+`, nowUnix(), w.listed, msg, w.targets[0].rule.ID); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+func (w *ScanWriter) flush(final bool) error {
+	tx, err := w.s.db.BeginTx(w.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, t := range w.targets {
+		if len(w.buf) > 0 {
+			if err := t.upsert(w.ctx, tx, w.buf); err != nil {
+				return err
+			}
+		}
+		if final {
+			if err := t.finish(w.ctx, tx); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.ExecContext(w.ctx, `UPDATE rule_scans SET listed=? WHERE rule_id=?`, w.listed, w.targets[0].rule.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	w.flushed = time.Now()
+	return nil
+}
+
+// GetScanProgress returns the rule's current or last scan; ok is false when it never scanned.
+func (s *Store) GetScanProgress(ctx context.Context, ruleID string) (ScanProgress, bool, error) {
+	p := ScanProgress{RuleID: ruleID}
+	var started, finished int64
+	var full int
+	err := s.db.QueryRowContext(ctx, `
+SELECT started_at, finished_at, full, listed, error
+FROM rule_scans
+WHERE rule_id=?
+`, ruleID).Scan(&started, &finished, &full, &p.Listed, &p.Error)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ScanProgress{}, false, nil
+	}
+	if err != nil {
+		return ScanProgress{}, false, err
+	}
+	p.StartedAt = time.Unix(started, 0)
+	if finished > 0 {
+		p.FinishedAt = time.Unix(finished, 0)
+	}
+	p.Full = full != 0
+	return p, true, nil
+}
@@ -0,0 +1,294 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A schedule (rule.job_schedule / rule.scan_schedule) lists one window per line; the schedule is
+// open whenever any line matches. '#' starts a comment. Times are in the daemon's local time zone.
+//
+//	mon-fri 22:00-07:00   weekdays and a time range; ranges may cross midnight
+//	sat,sun               whole days
+//	01:00-06:00           a time range on every day
+//	*/10 0-6 * * *        a 5-field cron expression: open during every minute it matches
+//
+// A range that crosses midnight belongs to the day it starts on: "fri 22:00-02:00" is open until
+// Saturday 02:00.
+
+// Schedule is a parsed schedule. A nil *Schedule is always open.
+type Schedule struct {
+	lines []scheduleLine
+}
+
+type scheduleLine struct {
+	cron *cronExpr
+
+	days       [7]bool // indexed by time.Weekday
+	start, end int     // minutes since midnight; start == end = the whole day
+}
+
+type cronExpr struct {
+	minute, hour, dom, month, dow []bool
+	domAny, dowAny                bool
+}
+
+var scheduleWeekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses a schedule; an empty schedule returns nil (always open).
+func ParseSchedule(raw string) (*Schedule, error) {
+	var s Schedule
+	for i, line := range strings.Split(raw, "\n") {
+		if j := strings.Index(line, "#"); j >= 0 {
+			line = line[:j]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		l, err := parseScheduleLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("schedule line %d: %w", i+1, err)
+		}
+		s.lines = append(s.lines, l)
+	}
+	if len(s.lines) == 0 {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+// Active reports whether the schedule is open at t.
+func (s *Schedule) Active(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	for _, l := range s.lines {
+		if l.active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextChange returns when the schedule next opens (if closed at t) or closes (if open at t),
+// at minute resolution. ok is false if that does not happen within the next 8 days.
+func (s *Schedule) NextChange(t time.Time) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, false
+	}
+	open := s.Active(t)
+	m := t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.Add(8 * 24 * time.Hour); m.Before(end); m = m.Add(time.Minute) {
+		if s.Active(m) != open {
+			return m, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (l scheduleLine) active(t time.Time) bool {
+	if l.cron != nil {
+		return l.cron.match(t)
+	}
+	mins := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case l.start == l.end:
+		return l.days[day]
+	case l.start < l.end:
+		return l.days[day] && mins >= l.start && mins < l.end
+	default:
+		// Crosses midnight: the evening part belongs to today, the morning part to yesterday.
+		return (l.days[day] && mins >= l.start) || (l.days[(day+6)%7] && mins < l.end)
+	}
+}
+
+func parseScheduleLine(line string) (scheduleLine, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 5 {
+		c, err := parseCron(fields)
+		if err != nil {
+			return scheduleLine{}, err
+		}
+		return scheduleLine{cron: c}, nil
+	}
+	var l scheduleLine
+	var daysSet, rangeSet bool
+	for _, f := range fields {
+		switch {
+		case strings.Contains(f, ":"):
+			if rangeSet {
+				return scheduleLine{}, fmt.Errorf("more than one time range: %q", line)
+			}
+			a, b, ok := strings.Cut(f, "-")
+			if !ok {
+				return scheduleLine{}, fmt.Errorf("time range must look like 22:00-07:00: %q", f)
+			}
+			var err error
+			if l.start, err = parseClock(a); err != nil {
+				return scheduleLine{}, err
+			}
+			if l.end, err = parseClock(b); err != nil {
+				return scheduleLine{}, err
+			}
+			rangeSet = true
+		default:
+			if daysSet {
+				return scheduleLine{}, fmt.Errorf("more than one weekday list: %q", line)
+			}
+			days, err := parseWeekdays(f)
+			if err != nil {
+				return scheduleLine{}, err
+			}
+			l.days = days
+			daysSet = true
+		}
+	}
+	if !daysSet {
+		for i := range l.days {
+			l.days[i] = true
+		}
+	}
+	return l, nil
+}
+
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hh, err1 := strconv.Atoi(h)
+	mm, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hh < 0 || mm < 0 || mm > 59 || hh > 24 || (hh == 24 && mm != 0) {
+		return 0, fmt.Errorf("invalid time: %q", s)
+	}
+	return (hh*60 + mm) % (24 * 60), nil
+}
+
+func parseWeekdays(s string) ([7]bool, error) {
+	var days [7]bool
+	if s == "*" || strings.EqualFold(s, "daily") {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		a, b, isRange := strings.Cut(part, "-")
+		from, ok := scheduleWeekdays[a]
+		if !ok {
+			return days, fmt.Errorf("unknown weekday: %q", a)
+		}
+		to := from
+		if isRange {
+			if to, ok = scheduleWeekdays[b]; !ok {
+				return days, fmt.Errorf("unknown weekday: %q", b)
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseCron(fields []string) (*cronExpr, error) {
+	var c cronExpr
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron minute: %w", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron hour: %w", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron day of month: %w", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, nil); err != nil {
+		return nil, fmt.Errorf("cron month: %w", err)
+	}
+	names := map[string]int{}
+	for k, v := range scheduleWeekdays {
+		names[k] = int(v)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, names); err != nil {
+		return nil, fmt.Errorf("cron day of week: %w", err)
+	}
+	c.dow[0] = c.dow[0] || c.dow[7]
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return &c, nil
+}
+
+// parseCronField parses a comma list of *, n, a-b, with an optional /step, into a set indexed by value.
+func parseCronField(f string, lo, hi int, names map[string]int) ([]bool, error) {
+	set := make([]bool, hi+1)
+	value := func(s string) (int, error) {
+		if n, ok := names[strings.ToLower(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < lo || n > hi {
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+		return n, nil
+	}
+	for _, part := range strings.Split(f, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = value(a); err != nil {
+				return nil, err
+			}
+			to = from
+			if isRange {
+				if to, err = value(b); err != nil {
+					return nil, err
+				}
+			} else if hasStep {
+				to = hi
+			}
+			if to < from {
+				return nil, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func (c *cronExpr) match(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	// Classic cron: when both day fields are restricted, either may match.
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
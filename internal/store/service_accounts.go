@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ServiceAccountScope is the quota pause scope of one service account of a limit group.
+func ServiceAccountScope(group, account string) string {
+	return "sa:" + group + ":" + account
+}
+
+// ListServiceAccounts returns the base names of the service-account JSON files in dir, sorted.
+func ListServiceAccounts(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(strings.ToLower(e.Name()), ".json") {
+			out = append(out, e.Name())
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// ServiceAccountBudgetSince is GroupBudgetSince for the jobs of group that ran as account:
+// bytes of those that ended in the window plus the size of files the running ones transfer.
+func (s *Store) ServiceAccountBudgetSince(ctx context.Context, group, account string, since time.Time) (int64, error) {
+	var ended int64
+	if err := s.db.QueryRowContext(ctx, `
+SELECT COALESCE(SUM(j.bytes_done), 0)
+FROM jobs j
+JOIN rules r ON j.rule_id = r.id
+WHERE r.limit_group = ?
+  AND j.service_account = ?
+  AND j.ended_at >= ?
+  AND j.status != 'running'
+`, group, account, since.Unix()).Scan(&ended); err != nil {
+		return 0, err
+	}
+
+	var inflight int64
+	if err := s.db.QueryRowContext(ctx, `
+SELECT COALESCE(SUM(f.size), 0)
+FROM files f
+JOIN jobs j ON f.job_id = j.job_id
+JOIN rules r ON j.rule_id = r.id
+WHERE r.limit_group = ?
+  AND j.service_account = ?
+  AND f.state = 'transferring'
+`, group, account).Scan(&inflight); err != nil {
+		return 0, err
+	}
+	return ended + inflight, nil
+}
@@ -58,6 +58,17 @@ type RuntimeSettings struct {
 	Bwlimit          string
 	MetricsInterval  time.Duration
 	SchedulerTick    time.Duration
+	// QuotaCooldown is how long new jobs wait after a provider quota error when no reset time is known.
+	QuotaCooldown    time.Duration
+	RetryMaxAttempts int
+	RetryBackoff     time.Duration
+	// FileEventRetentionDays is how long file_events are kept; 0 keeps them forever.
+	FileEventRetentionDays int
+}
+
+// RetryPolicy returns the retry policy for the files of failed jobs.
+func (r RuntimeSettings) RetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: r.RetryMaxAttempts, Backoff: r.RetryBackoff}
 }
 
 func (s *Store) RuntimeSettings(ctx context.Context) (RuntimeSettings, error) {
@@ -83,6 +94,10 @@ func (s *Store) RuntimeSettings(ctx context.Context) (RuntimeSettings, error) {
 		Bwlimit:          m["rclone_bwlimit"],
 		MetricsInterval:  time.Duration(parseIntDefault(m["metrics_interval_ms"], 2000)) * time.Millisecond,
 		SchedulerTick:    time.Duration(parseIntDefault(m["scheduler_tick_ms"], 2000)) * time.Millisecond,
+		QuotaCooldown:    time.Duration(parseIntDefault(m["quota_cooldown_min"], 60)) * time.Minute,
+		RetryMaxAttempts: parseIntDefault(m["retry_max_attempts"], 5),
+		RetryBackoff:     time.Duration(parseIntDefault(m["retry_backoff_sec"], 60)) * time.Second,
+		FileEventRetentionDays: parseIntDefault(m["file_event_retention_days"], 30),
 	}, nil
 }
 
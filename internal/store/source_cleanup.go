@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func (r *Rule) normalizeSourceCleanup() error {
+	r.SourceTrashDir = strings.TrimSpace(r.SourceTrashDir)
+	if r.SourceDeleteAfterDays < 0 {
+		r.SourceDeleteAfterDays = 0
+	}
+	if r.SourceDeleteWatermark < 0 || r.SourceDeleteWatermark >= 100 {
+		return errors.New("source_delete_watermark must be a percentage between 1 and 99")
+	}
+	if !r.SourceCleanup() {
+		return nil
+	}
+	if r.TransferMode != "copy" || r.IsManual {
+		return errors.New("source cleanup is only supported for copy rules")
+	}
+	if r.SrcKind != "local" && (r.SourceDeleteWatermark > 0 || r.SourceTrashDir != "") {
+		return errors.New("source_delete_watermark and source_trash_dir need a local source")
+	}
+	if r.SourceTrashDir != "" {
+		if !filepath.IsAbs(r.SourceTrashDir) {
+			return errors.New("source_trash_dir must be an absolute path")
+		}
+		// A trash inside the source would be scanned and transferred again.
+		if rel, err := filepath.Rel(filepath.Clean(r.SrcLocalRoot), filepath.Clean(r.SourceTrashDir)); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return errors.New("source_trash_dir must not be inside the source directory")
+		}
+	}
+	return nil
+}
+
+// SourceCleanup reports whether the rule deletes source files after copying them.
+func (r Rule) SourceCleanup() bool {
+	return r.SourceDeleteAfterDays > 0 || r.SourceDeleteWatermark > 0
+}
+
+// SourceFile is a transferred file whose source copy may be cleaned up.
+type SourceFile struct {
+	Path   string
+	Size   int64
+	DoneAt time.Time
+}
+
+// sourceCleanupRetry is how long a file whose cleanup failed is left alone.
+const sourceCleanupRetry = 24 * time.Hour
+
+// SourceCleanupCandidates returns up to limit files of the rule whose source copy can go, the
+// longest done first: still done (verified when the rule verifies), not deleted yet, done at or
+// before doneBefore (zero = any time), done for every fan-out replica too, and not failed to
+// clean up within the last day.
+func (s *Store) SourceCleanupCandidates(ctx context.Context, rule Rule, doneBefore time.Time, limit int) ([]SourceFile, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	states := `'done','verified'`
+	if rule.VerifyMode != "" {
+		states = `'verified'`
+	}
+	before := int64(1 << 62)
+	if !doneBefore.IsZero() {
+		before = doneBefore.Unix()
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT f.path, f.size, f.done_at
+FROM files f
+WHERE f.rule_id=? AND f.state IN (`+states+`) AND f.done_at>0 AND f.done_at<=? AND f.source_deleted_at=0
+  AND (f.done_unconfirmed=0 OR f.state='verified')
+  AND NOT EXISTS (
+    SELECT 1 FROM files g JOIN rules r ON r.id=g.rule_id
+    WHERE r.parent_id=f.rule_id AND g.path=f.path AND g.state NOT IN (`+states+`)
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM source_deletions d
+    WHERE d.rule_id=f.rule_id AND d.path=f.path AND d.error!='' AND d.at>?
+  )
+ORDER BY f.done_at ASC, f.path ASC
+LIMIT ?
+`, rule.ID, before, time.Now().Add(-sourceCleanupRetry).Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SourceFile
+	for rows.Next() {
+		var f SourceFile
+		var doneAt int64
+		if err := rows.Scan(&f.Path, &f.Size, &doneAt); err != nil {
+			return nil, err
+		}
+		f.DoneAt = time.Unix(doneAt, 0)
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// SourceDeletion is one attempt to clean up a source file.
+type SourceDeletion struct {
+	RuleID string
+	Path   string
+	Size   int64
+	// Reason is "age" or "watermark".
+	Reason string
+	// TrashPath is where the file was moved to instead of being deleted.
+	TrashPath string
+	Error     string
+	At        time.Time
+}
+
+// RecordSourceDeletion logs a cleanup attempt; a successful one also marks the file's source as
+// deleted and adds a source_deleted (or source_trashed) event to its history.
+func (s *Store) RecordSourceDeletion(ctx context.Context, d SourceDeletion) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	at := d.At.Unix()
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO source_deletions(rule_id, path, size, reason, trash_path, error, at)
+VALUES(?, ?, ?, ?, ?, ?, ?)
+`, d.RuleID, d.Path, d.Size, d.Reason, d.TrashPath, d.Error, at); err != nil {
+		return err
+	}
+	if d.Error == "" {
+		event := "source_deleted"
+		if d.TrashPath != "" {
+			event = "source_trashed"
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE files SET source_deleted_at=? WHERE rule_id=? AND path=?`, at, d.RuleID, d.Path); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO file_events(rule_id, path, at, event, state, job_id, size, error)
+SELECT rule_id, path, ?, ?, state, '', size, ''
+FROM files WHERE rule_id=? AND path=?
+`, at, event, d.RuleID, d.Path); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListSourceDeletions returns the rule's latest cleanup attempts, newest first.
+func (s *Store) ListSourceDeletions(ctx context.Context, ruleID string, limit int) ([]SourceDeletion, error) {
+	if limit <= 0 {
+		limit = 500
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT rule_id, path, size, reason, trash_path, error, at
+FROM source_deletions
+WHERE rule_id=?
+ORDER BY id DESC
+LIMIT ?
+`, ruleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SourceDeletion
+	for rows.Next() {
+		var d SourceDeletion
+		var at int64
+		if err := rows.Scan(&d.RuleID, &d.Path, &d.Size, &d.Reason, &d.TrashPath, &d.Error, &at); err != nil {
+			return nil, err
+		}
+		d.At = time.Unix(at, 0)
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
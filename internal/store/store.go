@@ -95,6 +95,59 @@ CREATE TABLE IF NOT EXISTS files (
 CREATE INDEX IF NOT EXISTS files_state_idx ON files(rule_id, state);
 CREATE INDEX IF NOT EXISTS files_job_idx ON files(job_id);
 
+CREATE TABLE IF NOT EXISTS file_events (
+  id INTEGER PRIMARY KEY,
+  rule_id TEXT NOT NULL,
+  path TEXT NOT NULL,
+  at INTEGER NOT NULL,
+  event TEXT NOT NULL,
+  state TEXT NOT NULL,
+  job_id TEXT NOT NULL DEFAULT '',
+  size INTEGER NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS file_events_file_idx ON file_events(rule_id, path);
+CREATE INDEX IF NOT EXISTS file_events_at_idx ON file_events(at);
+
+CREATE TABLE IF NOT EXISTS source_deletions (
+  id INTEGER PRIMARY KEY,
+  rule_id TEXT NOT NULL,
+  path TEXT NOT NULL,
+  size INTEGER NOT NULL DEFAULT 0,
+  reason TEXT NOT NULL,
+  trash_path TEXT NOT NULL DEFAULT '',
+  error TEXT NOT NULL DEFAULT '',
+  at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS source_deletions_rule_idx ON source_deletions(rule_id, at);
+
+CREATE TABLE IF NOT EXISTS scan_dirs (
+  rule_id TEXT NOT NULL,
+  path TEXT NOT NULL,
+  mod_time TEXT NOT NULL,
+  PRIMARY KEY (rule_id, path)
+);
+
+CREATE TABLE IF NOT EXISTS rule_scans (
+  rule_id TEXT PRIMARY KEY,
+  started_at INTEGER NOT NULL,
+  finished_at INTEGER NOT NULL DEFAULT 0,
+  full INTEGER NOT NULL DEFAULT 1,
+  listed INTEGER NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS dest_reconciles (
+  rule_id TEXT PRIMARY KEY,
+  at INTEGER NOT NULL,
+  dest_files INTEGER NOT NULL DEFAULT 0,
+  seeded INTEGER NOT NULL DEFAULT 0,
+  requeued INTEGER NOT NULL DEFAULT 0,
+  error TEXT NOT NULL DEFAULT ''
+);
+
 CREATE TABLE IF NOT EXISTS jobs (
   job_id TEXT PRIMARY KEY,
   rule_id TEXT NOT NULL,
@@ -123,12 +176,59 @@ CREATE TABLE IF NOT EXISTS job_metrics (
   FOREIGN KEY (job_id) REFERENCES jobs(job_id) ON DELETE CASCADE
 );
 
+CREATE TABLE IF NOT EXISTS bisync_listings (
+  rule_id TEXT NOT NULL,
+  side TEXT NOT NULL,
+  path TEXT NOT NULL,
+  size INTEGER NOT NULL,
+  mod_time TEXT NOT NULL,
+  PRIMARY KEY (rule_id, side, path),
+  FOREIGN KEY (rule_id) REFERENCES rules(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS job_conflicts (
+  job_id TEXT NOT NULL,
+  path TEXT NOT NULL,
+  src_size INTEGER NOT NULL,
+  src_mod_time TEXT NOT NULL,
+  dst_size INTEGER NOT NULL,
+  dst_mod_time TEXT NOT NULL,
+  resolution TEXT NOT NULL,
+  renamed_to TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (job_id, path),
+  FOREIGN KEY (job_id) REFERENCES jobs(job_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS job_verify_failures (
+  job_id TEXT NOT NULL,
+  path TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  PRIMARY KEY (job_id, path),
+  FOREIGN KEY (job_id) REFERENCES jobs(job_id) ON DELETE CASCADE
+);
+
 CREATE TABLE IF NOT EXISTS limit_groups (
   name TEXT PRIMARY KEY,
   daily_limit_bytes INTEGER NOT NULL DEFAULT 0,
   updated_at INTEGER NOT NULL
 );
 
+CREATE TABLE IF NOT EXISTS limit_group_fallbacks (
+  group_name TEXT NOT NULL,
+  position INTEGER NOT NULL,
+  dst_remote TEXT NOT NULL,
+  daily_limit_bytes INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (group_name, position),
+  FOREIGN KEY (group_name) REFERENCES limit_groups(name) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS quota_pauses (
+  scope TEXT PRIMARY KEY,
+  until INTEGER NOT NULL,
+  reason TEXT NOT NULL DEFAULT '',
+  created_at INTEGER NOT NULL
+);
+
 CREATE TABLE IF NOT EXISTS extension_presets (
   name TEXT PRIMARY KEY,
   extensions TEXT NOT NULL DEFAULT '',
@@ -176,13 +276,185 @@ CREATE TABLE IF NOT EXISTS settings (
 	if err := s.ensureRuleColumn(ctx, "ignore_extensions", "TEXT NOT NULL DEFAULT ''"); err != nil {
 		return err
 	}
+	if err := s.ensureRuleColumn(ctx, "max_delete", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "conflict_policy", "TEXT NOT NULL DEFAULT 'newer'"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "dst_path", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "parent_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "dst_remote", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "jobs", "dst_remote", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "verify_mode", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "jobs", "verify_status", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "jobs", "verify_passed", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "jobs", "verify_failed", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "jobs", "verify_error", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "filters", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "extension_presets", "filters", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "upstream_rule", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "upstream_rule_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "upstream_path", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS files_upstream_idx ON files(upstream_rule_id, upstream_path)`); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "job_schedule", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "scan_schedule", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "window_policy", "TEXT NOT NULL DEFAULT 'finish'"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "window_bwlimit", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "queue_order", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "priority_rules", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "priority", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "pinned_at", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "first_seen", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE files SET first_seen=last_seen WHERE first_seen=0`); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "batch_max_bytes", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "limit_groups", "weekly_limit_bytes", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "limit_groups", "monthly_limit_bytes", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "limit_groups", "reset_mode", "TEXT NOT NULL DEFAULT 'rolling'"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "limit_groups", "reset_time", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "limit_groups", "timezone", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "limit_groups", "daily_limit_files", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "jobs", "files_done", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "limit_groups", "sa_dir", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "limit_groups", "sa_daily_limit_bytes", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "jobs", "service_account", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "next_attempt_at", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "error_permanent", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "missing_action", "TEXT NOT NULL DEFAULT 'keep'"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "missing_grace_scans", "INTEGER NOT NULL DEFAULT 2"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "missed_scans", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "source_delete_after_days", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "source_delete_watermark", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "source_trash_dir", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "done_at", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "source_deleted_at", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "seed_from_dest", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureColumn(ctx, "files", "done_unconfirmed", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "scan_strategy", "TEXT NOT NULL DEFAULT 'full'"); err != nil {
+		return err
+	}
+	if err := s.ensureRuleColumn(ctx, "full_scan_interval_sec", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	// Signature of the filter last applied to the rule's pending rows (see scanTarget.finish).
+	if err := s.ensureRuleColumn(ctx, "filter_applied", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, fileEventTriggers); err != nil {
+		return err
+	}
 	return nil
 }
 
 func nowUnix() int64 { return time.Now().Unix() }
 
+// execer is what *sql.DB and *sql.Tx have in common for writes.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
 func (s *Store) ensureRuleColumn(ctx context.Context, col, ddl string) error {
-	rows, err := s.db.QueryContext(ctx, `PRAGMA table_info(rules)`)
+	return s.ensureColumn(ctx, "rules", col, ddl)
+}
+
+func (s *Store) ensureColumn(ctx context.Context, table, col, ddl string) error {
+	rows, err := s.db.QueryContext(ctx, `PRAGMA table_info(`+table+`)`)
 	if err != nil {
 		return err
 	}
@@ -203,7 +475,7 @@ func (s *Store) ensureRuleColumn(ctx context.Context, col, ddl string) error {
 	if err := rows.Err(); err != nil {
 		return err
 	}
-	_, err = s.db.ExecContext(ctx, `ALTER TABLE rules ADD COLUMN `+col+` `+ddl)
+	_, err = s.db.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN `+col+` `+ddl)
 	return err
 }
 
@@ -221,6 +493,10 @@ type DefaultSettings struct {
 	Bwlimit          string
 	MetricsInterval  time.Duration
 	SchedulerTick    time.Duration
+	QuotaCooldown    time.Duration
+	RetryMaxAttempts int
+	RetryBackoff     time.Duration
+	FileEventRetentionDays int
 }
 
 func (s *Store) EnsureDefaultSettings(ctx context.Context, d DefaultSettings) error {
@@ -272,6 +548,18 @@ ON CONFLICT(key) DO NOTHING
 	if err := setIfMissing("scheduler_tick_ms", fmt.Sprintf("%d", d.SchedulerTick.Milliseconds())); err != nil {
 		return err
 	}
+	if err := setIfMissing("quota_cooldown_min", fmt.Sprintf("%d", int(d.QuotaCooldown.Minutes()))); err != nil {
+		return err
+	}
+	if err := setIfMissing("retry_max_attempts", fmt.Sprintf("%d", d.RetryMaxAttempts)); err != nil {
+		return err
+	}
+	if err := setIfMissing("retry_backoff_sec", fmt.Sprintf("%d", int(d.RetryBackoff.Seconds()))); err != nil {
+		return err
+	}
+	if err := setIfMissing("file_event_retention_days", fmt.Sprintf("%d", d.FileEventRetentionDays)); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Rules with a verify_mode check the files of every finished job at the destination. Files that
+// match move from done to verified; mismatches count as a failed attempt under the retry policy
+// (see RetryPolicy) with a verify_failed error.
+
+// JobVerifyFailure is a file that did not match at the destination after its job.
+type JobVerifyFailure struct {
+	JobID  string
+	Path   string
+	Reason string
+}
+
+// JobDoneFileSizes returns the recorded size of every file the job transferred.
+func (s *Store) JobDoneFileSizes(ctx context.Context, jobID string) (map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT path, size FROM files WHERE job_id=? AND state='done'`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int64{}
+	for rows.Next() {
+		var p string
+		var n int64
+		if err := rows.Scan(&p, &n); err != nil {
+			return nil, err
+		}
+		out[p] = n
+	}
+	return out, rows.Err()
+}
+
+// RecordJobVerify stores the outcome of verifying a job: verified paths become 'verified',
+// failed ones are retried or given up on like the files of a failed job.
+func (s *Store) RecordJobVerify(ctx context.Context, jobID string, verified []string, failed []JobVerifyFailure) error {
+	settings, err := s.RuntimeSettings(ctx)
+	if err != nil {
+		return err
+	}
+	policy := settings.RetryPolicy()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, p := range verified {
+		if _, err := tx.ExecContext(ctx, `
+UPDATE files
+SET state='verified'
+WHERE job_id=? AND path=? AND state='done'
+`, jobID, p); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	for _, f := range failed {
+		var count int
+		err := tx.QueryRowContext(ctx, `SELECT fail_count FROM files WHERE job_id=? AND path=? AND state='done'`, jobID, f.Path).Scan(&count)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return err
+		default:
+			if err := failFile(ctx, tx, jobID, f.Path, count+1, FileError{Reason: "verify_failed: " + f.Reason}, policy, now); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+INSERT OR REPLACE INTO job_verify_failures(job_id, path, reason)
+VALUES(?, ?, ?)
+`, jobID, f.Path, f.Reason); err != nil {
+			return err
+		}
+	}
+	status := "passed"
+	if len(failed) > 0 {
+		status = "failed"
+	}
+	if _, err := tx.ExecContext(ctx, `
+UPDATE jobs
+SET verify_status=?, verify_passed=?, verify_failed=?, verify_error=''
+WHERE job_id=?
+`, status, len(verified), len(failed), jobID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordJobVerifyError notes that verification could not run; the job's files stay done.
+func (s *Store) RecordJobVerifyError(ctx context.Context, jobID, errMsg string) error {
+	_, err := s.db.ExecContext(ctx, `
+UPDATE jobs
+SET verify_status='error', verify_error=?
+WHERE job_id=?
+`, strings.TrimSpace(errMsg), jobID)
+	return err
+}
+
+func (s *Store) ListJobVerifyFailures(ctx context.Context, jobID string) ([]JobVerifyFailure, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT job_id, path, reason
+FROM job_verify_failures
+WHERE job_id=?
+ORDER BY path
+`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []JobVerifyFailure
+	for rows.Next() {
+		var f JobVerifyFailure
+		if err := rows.Scan(&f.JobID, &f.Path, &f.Reason); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}